@@ -0,0 +1,361 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/encryption"
+	"github.com/genevieve/az-automation/simulator"
+	flags "github.com/jessevdk/go-flags"
+)
+
+// Exit codes of Run.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitInterrupted = 130
+)
+
+// Signalled is the cause of a context cancelled because the process received
+// the signal.
+type Signalled struct {
+	Signal os.Signal
+}
+
+func (s Signalled) Error() string {
+	return fmt.Sprintf("Received %s.", s.Signal)
+}
+
+type Executor interface {
+	Execute(ctx context.Context, args []string) (string, error)
+}
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// App runs the az-automation commands. A CLI, Clock or FS left nil is
+// replaced by the real thing: the backend chosen by the flags, which is the
+// azure-cli on the PATH by default, the system clock and the local
+// filesystem. The FS holds the batch files and credential output files; the
+// journal, state, trace and cassette are always on the local filesystem.
+// Stdin is read by the wizard, which only runs when Terminal is set.
+type App struct {
+	CLI      Executor
+	Clock    Clock
+	FS       FileSystem
+	Stdin    io.Reader
+	Terminal bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// invocation is a single run of a command, with the environment and output
+// streams it was given.
+type invocation struct {
+	App
+	env     map[string]string
+	stdout  io.Writer
+	stderr  io.Writer
+	logger  *az.Logger
+	version az.CLIVersion
+}
+
+// errHelp is returned once the help of a command has been printed.
+var errHelp = errors.New("help")
+
+// usageError is a problem with the arguments of a command. Missing is set
+// when required flags were not given.
+type usageError struct {
+	message string
+	missing bool
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+// Run runs the command named by the first argument, or creates a single
+// principal when there is none, and returns its exit code. The environment
+// is a list of key=value pairs, like os.Environ. Errors are logged to
+// stderr; once the context is cancelled the command stops and
+// ExitInterrupted is returned, or 128 plus the number of the signal when it
+// was cancelled with a Signalled cause, e.g. 143 for SIGTERM.
+func (a App) Run(ctx context.Context, args []string, env []string, stdout, stderr io.Writer) int {
+	if a.Clock == nil {
+		a.Clock = systemClock{}
+	}
+	if a.FS == nil {
+		a.FS = az.OSFileSystem{}
+	}
+	if a.Stdin == nil {
+		a.Stdin = strings.NewReader("")
+	}
+
+	i := &invocation{
+		App:    a,
+		env:    environment(env),
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	err := i.run(ctx, args)
+	switch {
+	case err == nil, err == errHelp:
+		return ExitOK
+	case ctx.Err() == context.Canceled:
+		i.report(err)
+		return interruptedCode(ctx)
+	}
+
+	i.report(err)
+	if _, ok := err.(usageError); ok {
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// interruptedCode is the exit code of a run whose context was cancelled.
+func interruptedCode(ctx context.Context) int {
+	var signalled Signalled
+	if errors.As(context.Cause(ctx), &signalled) {
+		if sig, ok := signalled.Signal.(syscall.Signal); ok {
+			return 128 + int(sig)
+		}
+	}
+	return ExitInterrupted
+}
+
+func (i *invocation) run(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "decrypt":
+			return i.decrypt(args[1:])
+		case "batch":
+			return i.batch(ctx, args[1:])
+		case "resume":
+			return i.resume(ctx, args[1:])
+		case "list":
+			return i.listPrincipals(args[1:])
+		case "show":
+			return i.showPrincipal(args[1:])
+		case "destroy":
+			return i.destroyPrincipal(ctx, args[1:])
+		case "rotate":
+			return i.rotatePrincipal(ctx, args[1:])
+		case "import":
+			return i.importPrincipal(ctx, args[1:])
+		case "doctor":
+			return i.doctor(ctx, args[1:])
+		}
+	}
+
+	return i.provisionOne(ctx, args)
+}
+
+// report logs the error, or writes it to stderr when the command failed
+// before its logger was set up.
+func (i *invocation) report(err error) {
+	if i.logger != nil {
+		i.logger.Error(err.Error())
+		return
+	}
+	fmt.Fprintln(i.stderr, err)
+}
+
+func environment(env []string) map[string]string {
+	values := map[string]string{}
+	for _, pair := range env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	return values
+}
+
+// parse parses the arguments of a command into the group of options in data.
+// The help is printed to stdout.
+func (i *invocation) parse(name, group string, data interface{}, arguments []string) error {
+	parser := flags.NewNamedParser(name, flags.HelpFlag)
+	_, err := parser.AddGroup(group, "", data)
+	if err != nil {
+		return err
+	}
+
+	_, err = parser.ParseArgs(arguments)
+	if err == nil {
+		return nil
+	}
+	flagsErr, ok := err.(*flags.Error)
+	if ok && flagsErr.Type == flags.ErrHelp {
+		fmt.Fprintln(i.stdout, err)
+		return errHelp
+	}
+	return usageError{message: err.Error(), missing: ok && flagsErr.Type == flags.ErrRequired}
+}
+
+// startLogging logs to stderr at the level and in the format of the flags.
+func (i *invocation) startLogging(l logArgs) *az.Logger {
+	level := az.LevelInfo
+	if l.Quiet {
+		level = az.LevelWarn
+	}
+	if l.Verbose {
+		level = az.LevelDebug
+	}
+
+	i.logger = az.NewLogger(i.stderr, level, l.LogFormat)
+	return i.logger
+}
+
+// runContext is done once the timeout has passed, if there is one.
+func runContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// setup builds the backend the azure-cli commands are sent to and checks its
+// version, which is kept to check the features used against and decides the
+// dialect of the `az ad` commands. With a rate limit the commands of all
+// principals are spaced out to avoid throttling. Logging must have been
+// started. The returned func closes the trace file and cassette once the
+// command is done.
+func (i *invocation) setup(ctx context.Context, c cliArgs, commandTimeout time.Duration, rateLimit float64) (Executor, *az.Az, func(), error) {
+	cli, azure, done, err := i.backend(c, commandTimeout, rateLimit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	i.version, err = azure.Version(ctx)
+	if err != nil {
+		done()
+		return nil, nil, nil, err
+	}
+
+	return cli, azure.WithDialect(i.version.Dialect()), done, nil
+}
+
+// backend builds the backend the azure-cli commands are sent to: the injected
+// CLI, a cassette, the simulator or the azure-cli on the PATH. The returned
+// func closes the trace file and cassette.
+func (i *invocation) backend(c cliArgs, commandTimeout time.Duration, rateLimit float64) (Executor, *az.Az, func(), error) {
+	logger := i.logger
+
+	if c.Replay != "" && (c.Record != "" || c.Backend == "simulated") {
+		return nil, nil, nil, usageError{message: "Use --replay without --record or --backend simulated."}
+	}
+
+	var files []io.Closer
+	done := func() {
+		for _, file := range files {
+			if err := file.Close(); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to close: %s", err), az.F("step", "az"))
+			}
+		}
+	}
+
+	var cli Executor
+	var err error
+	switch {
+	case i.CLI != nil:
+		cli = i.CLI
+	case c.Replay != "":
+		cli, err = az.NewReplayCLI(c.Replay)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	case c.Backend == "simulated":
+		cli = simulator.New(simulator.Config{
+			Version:          c.SimulatedVersion,
+			ReplicationDelay: c.SimulatedReplicationDelay,
+			CallsPerSecond:   c.SimulatedCallsPerSecond,
+		})
+	default:
+		path, err := exec.LookPath("az")
+		if err != nil {
+			return nil, nil, nil, errors.New(fmt.Sprintf("Failed to find the azure-cli (`az`): %s", err))
+		}
+		cli = az.NewCLI(path, commandTimeout, i.cliEnvironment(c.AzureConfigDir), logger)
+	}
+
+	if c.Record != "" {
+		recording, err := az.NewRecordingCLI(cli, c.Record)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		files = append(files, recording)
+		cli = recording
+	}
+
+	var trace io.Writer
+	if c.TraceFile != "" {
+		file, err := os.OpenFile(c.TraceFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			done()
+			return nil, nil, nil, errors.New(fmt.Sprintf("Failed to open the trace file: %s", err))
+		}
+		files = append(files, file)
+		trace = file
+	}
+
+	cli = az.NewTracedCLI(cli, logger, trace)
+	if rateLimit > 0 {
+		cli = az.NewRateLimitedCLI(cli, rateLimit)
+	}
+
+	return cli, az.NewAz(cli, logger), done, nil
+}
+
+// cliEnvironment is the environment of the azure-cli: the environment of the
+// invocation, with the config directory when one was given.
+func (i *invocation) cliEnvironment(configDir string) []string {
+	var env []string
+	for name, value := range i.env {
+		if name == "AZURE_CONFIG_DIR" && configDir != "" {
+			continue
+		}
+		env = append(env, name+"="+value)
+	}
+	if configDir != "" {
+		env = append(env, "AZURE_CONFIG_DIR="+configDir)
+	}
+	sort.Strings(env)
+	return env
+}
+
+func (i *invocation) decrypt(arguments []string) error {
+	var d decryptArgs
+	err := i.parse("az-automation decrypt", "Decrypt Options", &d, arguments)
+	if err != nil {
+		return err
+	}
+
+	return encryption.DecryptFile(d.Args.File, d.Output, d.Identity, i.stdout)
+}
@@ -0,0 +1,595 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/genevieve/az-automation/app"
+	"github.com/genevieve/az-automation/app/fakes"
+	azfakes "github.com/genevieve/az-automation/az/fakes"
+	"github.com/genevieve/az-automation/simulator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("App", func() {
+	var (
+		dir    string
+		sim    *simulator.Simulator
+		cli    *azfakes.CLI
+		clock  *fakes.Clock
+		fs     *fakes.FileSystem
+		stdout *bytes.Buffer
+		stderr *bytes.Buffer
+
+		application app.App
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "app")
+		Expect(err).NotTo(HaveOccurred())
+
+		sim = simulator.New(simulator.Config{})
+		cli = &azfakes.CLI{}
+		cli.ExecuteCall.Stub = func(args []string) (string, error) {
+			return sim.Execute(context.Background(), args)
+		}
+
+		clock = &fakes.Clock{}
+		clock.NowCall.Returns.Time = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		fs = &fakes.FileSystem{}
+		stdout = &bytes.Buffer{}
+		stderr = &bytes.Buffer{}
+
+		application = app.App{CLI: cli, Clock: clock, FS: fs}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	run := func(args ...string) int {
+		return application.Run(context.Background(), args, nil, stdout, stderr)
+	}
+
+	files := func(args ...string) []string {
+		return append(args,
+			"--state", filepath.Join(dir, "state.json"),
+			"--journal", filepath.Join(dir, "journal"),
+		)
+	}
+
+	Describe("creating a principal", func() {
+		It("runs every step in order and writes the credentials", func() {
+			code := run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--role", "Reader")...)
+			Expect(stderr.String()).To(ContainSubstring("Provisioned principal."))
+			Expect(code).To(Equal(app.ExitOK))
+
+			var commands []string
+			for _, args := range cli.ExecuteCall.Receives.AllArgs {
+				var words []string
+				for _, arg := range args {
+					if strings.HasPrefix(arg, "-") {
+						break
+					}
+					words = append(words, arg)
+				}
+				commands = append(commands, strings.Join(words, " "))
+			}
+			Expect(commands).To(Equal([]string{
+				"version",
+				"cloud show",
+				"account list",
+				"rest",
+				"role assignment list",
+				"ad app list",
+				"ad app create",
+				"ad app credential reset",
+				"ad app update",
+				"ad sp create",
+				"role assignment create",
+				"ad app show",
+			}))
+
+			Expect(clock.AfterCall.Receives.Duration).To(Equal(30 * time.Second))
+
+			creds, err := fs.ReadFile("creds.tfvars")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(creds)).To(ContainSubstring(`subscription_id = "` + simulator.SubscriptionId + `"`))
+			Expect(fs.Perm("creds.tfvars")).To(Equal(os.FileMode(0600)))
+
+			Expect(run("list", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+			Expect(stdout.String()).To(ContainSubstring("some-app"))
+			Expect(stdout.String()).To(ContainSubstring("file:creds.tfvars"))
+		})
+
+		Context("when a step fails", func() {
+			It("logs the error and exits with a failure", func() {
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--role", "Wizard")...)).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("ERROR Running"))
+				Expect(stderr.String()).To(ContainSubstring("Role 'Wizard' doesn't exist."))
+			})
+		})
+
+		Context("when another cloud is selected", func() {
+			It("uses it and makes the cloud that was active before active again", func() {
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--cloud", "AzureUSGovernment")...)).To(Equal(app.ExitOK))
+				Expect(cli.ExecuteCall.Receives.AllArgs).To(ContainElement([]string{"cloud", "set", "--name", "AzureUSGovernment"}))
+
+				creds, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(creds)).To(ContainSubstring(`environment = "usgovernment"`))
+
+				output, _ := sim.Execute(context.Background(), []string{"cloud", "show"})
+				Expect(output).To(ContainSubstring(`"name": "AzureCloud"`))
+			})
+		})
+
+		Context("when the azure-cli speaks Azure AD Graph", func() {
+			It("sets the client secret when creating the application", func() {
+				sim = simulator.New(simulator.Config{Version: "2.30.0"})
+
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars")...)).To(Equal(app.ExitOK))
+
+				var creates [][]string
+				for _, args := range cli.ExecuteCall.Receives.AllArgs {
+					if strings.Join(args[:2], " ") == "ad app" {
+						creates = append(creates, args)
+					}
+				}
+				Expect(creates[1]).To(ContainElement("--password"))
+				Expect(cli.ExecuteCall.Receives.AllArgs).NotTo(ContainElement(ContainElement("credential")))
+
+				creds, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(creds)).To(MatchRegexp(`client_secret = "[0-9a-f-]{36}"`))
+			})
+		})
+
+		Context("when the azure-cli is too old for a feature", func() {
+			It("creates nothing and names the feature", func() {
+				sim = simulator.New(simulator.Config{Version: "2.30.0"})
+
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--federated-preset", "github", "--federated-subject", "repo:some-org/some-repo:ref:refs/heads/main")...)).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("Creating federated credentials needs azure-cli 2.37.0 or later, but 2.30.0 is installed."))
+
+				output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+				Expect(output).To(MatchJSON("[]"))
+			})
+		})
+
+		Context("when the azure-json format has no resource group or location", func() {
+			It("creates nothing", func() {
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "azure.json", "--credential-output-format", "azure-json")...)).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("Please provide a resource group and location for the azure.json."))
+
+				output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+				Expect(output).To(MatchJSON("[]"))
+				output, _ = sim.Execute(context.Background(), []string{"role", "assignment", "list", "--all"})
+				Expect(output).NotTo(ContainSubstring("ServicePrincipal"))
+			})
+		})
+
+		Context("when the environment of a sink is missing", func() {
+			It("creates nothing", func() {
+				for _, sink := range []string{"vault", "credhub"} {
+					args := []string{"--display-name", "some-app", "--sink", sink}
+					if sink == "vault" {
+						args = append(args, "--vault-path", "some/path")
+					} else {
+						args = append(args, "--credhub-name", "/some/name")
+					}
+					Expect(run(files(args...)...)).To(Equal(app.ExitFailure))
+				}
+				Expect(stderr.String()).To(ContainSubstring("Please set VAULT_ADDR and VAULT_TOKEN to use the vault sink."))
+				Expect(stderr.String()).To(ContainSubstring("Please set CREDHUB_SERVER, CREDHUB_CLIENT and CREDHUB_SECRET to use the credhub sink."))
+
+				output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+				Expect(output).To(MatchJSON("[]"))
+				output, _ = sim.Execute(context.Background(), []string{"role", "assignment", "list", "--all"})
+				Expect(output).NotTo(ContainSubstring("ServicePrincipal"))
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			It("exits as interrupted", func() {
+				application.CLI = sim
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				code := application.Run(ctx, files("--display-name", "some-app", "--credential-output-file", "creds.tfvars"), nil, stdout, stderr)
+				Expect(code).To(Equal(app.ExitInterrupted))
+			})
+
+			Context("while the client secret is set", func() {
+				It("deletes the application", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					application.CLI = executorFunc(func(ctx context.Context, args []string) (string, error) {
+						if strings.HasPrefix(strings.Join(args, " "), "ad app credential reset") {
+							cancel()
+						}
+						return sim.Execute(ctx, args)
+					})
+
+					code := application.Run(ctx, files("--display-name", "some-app", "--credential-output-file", "creds.tfvars"), nil, stdout, stderr)
+					Expect(code).To(Equal(app.ExitInterrupted))
+
+					output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+					Expect(output).To(MatchJSON("[]"))
+				})
+			})
+
+			Context("after roles were assigned", func() {
+				It("deletes the role assignments along with the application", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					application.CLI = executorFunc(func(ctx context.Context, args []string) (string, error) {
+						output, err := sim.Execute(ctx, args)
+						if strings.HasPrefix(strings.Join(args, " "), "role assignment create") {
+							cancel()
+						}
+						return output, err
+					})
+
+					code := application.Run(ctx, files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--role", "Reader", "--role", "Contributor"), nil, stdout, stderr)
+					Expect(code).To(Equal(app.ExitInterrupted))
+
+					output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+					Expect(output).To(MatchJSON("[]"))
+					output, _ = sim.Execute(context.Background(), []string{"role", "assignment", "list", "--all"})
+					Expect(output).NotTo(ContainSubstring("Reader"))
+				})
+			})
+
+			Context("by SIGTERM", func() {
+				It("exits with 128 plus the signal number", func() {
+					application.CLI = sim
+
+					ctx, cancel := context.WithCancelCause(context.Background())
+					cancel(app.Signalled{Signal: syscall.SIGTERM})
+
+					code := application.Run(ctx, files("--display-name", "some-app", "--credential-output-file", "creds.tfvars"), nil, stdout, stderr)
+					Expect(code).To(Equal(143))
+				})
+			})
+		})
+	})
+
+	Describe("record and replay", func() {
+		It("writes a cassette and trace that replay the run", func() {
+			cassette := filepath.Join(dir, "cassette.jsonl")
+			trace := filepath.Join(dir, "trace.jsonl")
+			Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--record", cassette, "--trace-file", trace)...)).To(Equal(app.ExitOK))
+
+			contents, err := ioutil.ReadFile(trace)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(contents), "\n")).To(Equal(cli.ExecuteCall.CallCount))
+
+			application.CLI = nil
+			code := run("--display-name", "some-app", "--credential-output-file", "replayed.tfvars", "--replay", cassette,
+				"--state", filepath.Join(dir, "replayed.json"), "--journal", filepath.Join(dir, "replayed-journal"))
+			Expect(code).To(Equal(app.ExitOK), stderr.String())
+		})
+	})
+
+	Describe("flags", func() {
+		It("exits with a usage error when a flag is wrong", func() {
+			Expect(run("--no-such-flag")).To(Equal(app.ExitUsage))
+			Expect(stderr.String()).To(ContainSubstring("unknown flag `no-such-flag'"))
+			Expect(cli.ExecuteCall.CallCount).To(Equal(0))
+		})
+
+		It("exits with a usage error when a required flag is missing", func() {
+			Expect(run("--credential-output-file", "creds.tfvars")).To(Equal(app.ExitUsage))
+			Expect(stderr.String()).To(ContainSubstring("the required flag `-d, --display-name' was not specified"))
+		})
+
+		It("prints the help to stdout", func() {
+			Expect(run("destroy", "--help")).To(Equal(app.ExitOK))
+			Expect(stdout.String()).To(ContainSubstring("az-automation destroy"))
+			Expect(stderr.String()).To(BeEmpty())
+		})
+	})
+
+	Describe("batch", func() {
+		It("provisions the principals of the batch file and prints a summary", func() {
+			Expect(fs.WriteFile("principals.csv", []byte("display_name,credential_output_file\nfirst-app,first.tfvars\nsecond-app,second.tfvars\n"), 0644)).To(Succeed())
+
+			Expect(run(files("batch", "--file", "principals.csv", "--rate-limit", "0")...)).To(Equal(app.ExitOK))
+			Expect(stdout.String()).To(ContainSubstring("first-app"))
+			Expect(stdout.String()).To(ContainSubstring("second-app"))
+
+			_, err := fs.ReadFile("first.tfvars")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fs.ReadFile("second.tfvars")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when a principal fails", func() {
+			It("exits with a failure", func() {
+				Expect(fs.WriteFile("principals.csv", []byte("display_name,credential_output_file,roles\nfirst-app,first.tfvars,Reader\nsecond-app,second.tfvars,Wizard\n"), 0644)).To(Succeed())
+
+				Expect(run(files("batch", "--file", "principals.csv", "--rate-limit", "0")...)).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("1 of 2 principals failed."))
+			})
+		})
+
+		Context("when the batch file does not exist", func() {
+			It("exits with a failure", func() {
+				Expect(run(files("batch", "--file", "missing.csv")...)).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("Opening batch file: "))
+			})
+		})
+	})
+
+	Describe("resume", func() {
+		commands := func() []string {
+			var commands []string
+			for _, args := range cli.ExecuteCall.Receives.AllArgs {
+				commands = append(commands, strings.Join(args, " "))
+			}
+			return commands
+		}
+
+		Context("when a run died after creating the application", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Stub = func(args []string) (string, error) {
+					if strings.HasPrefix(strings.Join(args, " "), "ad sp create") {
+						return "ERROR: The connection was reset.", errors.New("exit status 1")
+					}
+					return sim.Execute(context.Background(), args)
+				}
+				Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars", "--role", "Reader")...)).To(Equal(app.ExitFailure))
+
+				cli.ExecuteCall.Stub = func(args []string) (string, error) {
+					return sim.Execute(context.Background(), args)
+				}
+				cli.ExecuteCall.Receives.AllArgs = nil
+			})
+
+			It("skips the steps already done and replaces the lost client secret", func() {
+				Expect(run("resume", "--journal", filepath.Join(dir, "journal"))).To(Equal(app.ExitOK), stderr.String())
+
+				Expect(commands()).NotTo(ContainElement(HavePrefix("ad app create")))
+				Expect(commands()).To(ContainElement(HavePrefix("ad app credential reset")))
+				Expect(commands()).To(ContainElement(HavePrefix("ad sp create")))
+				Expect(commands()).To(ContainElement(HavePrefix("role assignment create --role Reader")))
+
+				output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+				var applications []interface{}
+				Expect(json.Unmarshal([]byte(output), &applications)).To(Succeed())
+				Expect(applications).To(HaveLen(1))
+
+				creds, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(creds)).To(ContainSubstring("client_secret = "))
+			})
+
+			Context("and the resumed run finished", func() {
+				It("refuses to resume it again", func() {
+					Expect(run("resume", "--journal", filepath.Join(dir, "journal"))).To(Equal(app.ExitOK), stderr.String())
+					cli.ExecuteCall.Receives.AllArgs = nil
+
+					Expect(run("resume", "--journal", filepath.Join(dir, "journal"))).To(Equal(app.ExitFailure))
+					Expect(stderr.String()).To(ContainSubstring("is complete, so there is nothing to resume."))
+					Expect(commands()).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("doctor", func() {
+		It("checks the environment without creating anything", func() {
+			Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "creds.tfvars"))).To(Equal(app.ExitOK))
+			Expect(stdout.String()).To(ContainSubstring("PASS    azure-cli        Version " + simulator.Version + "."))
+			Expect(stdout.String()).To(ContainSubstring("trainee@simulated.onmicrosoft.com may register applications as Application Administrator."))
+			Expect(stdout.String()).To(ContainSubstring("may assign roles at /subscriptions/" + simulator.SubscriptionId + " as Owner."))
+
+			output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+			Expect(output).To(MatchJSON("[]"))
+			entries, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("keeps the access token out of the trace and cassette", func() {
+			cassette := filepath.Join(dir, "cassette.jsonl")
+			trace := filepath.Join(dir, "trace.jsonl")
+			Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "creds.tfvars"), "--record", cassette, "--trace-file", trace)).To(Equal(app.ExitOK))
+
+			for _, path := range []string{cassette, trace} {
+				contents, err := ioutil.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("get-access-token"))
+				Expect(string(contents)).NotTo(ContainSubstring("simulated-token"))
+			}
+		})
+
+		It("prints the checks as json", func() {
+			Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "creds.tfvars"), "--format", "json")).To(Equal(app.ExitOK))
+
+			var checks []struct {
+				Name   string `json:"name"`
+				Status string `json:"status"`
+			}
+			Expect(json.Unmarshal(stdout.Bytes(), &checks)).To(Succeed())
+			Expect(checks).To(HaveLen(8))
+			for _, c := range checks {
+				Expect(c.Status).To(Equal("pass"), c.Name)
+			}
+		})
+
+		Context("when the user cannot assign roles at the scope", func() {
+			It("fails the check and exits with a failure", func() {
+				Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "creds.tfvars"), "--scope", "/subscriptions/other-subscription")).To(Equal(app.ExitFailure))
+				Expect(stdout.String()).To(ContainSubstring("FAIL    role-assignment"))
+				Expect(stderr.String()).To(ContainSubstring("1 of 8 checks failed."))
+			})
+		})
+
+		Context("when the cloud is not active", func() {
+			It("warns without making it active", func() {
+				Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "creds.tfvars"), "--cloud", "AzureUSGovernment")).To(Equal(app.ExitOK))
+				Expect(stdout.String()).To(ContainSubstring("WARN    cloud"))
+				Expect(stdout.String()).To(ContainSubstring("SKIP    login"))
+
+				Expect(cli.ExecuteCall.Receives.AllArgs).NotTo(ContainElement(ContainElement("set")))
+			})
+		})
+
+		Context("when the output directory does not exist", func() {
+			It("fails the check", func() {
+				Expect(run("doctor", "--credential-output-file", filepath.Join(dir, "missing", "creds.tfvars"))).To(Equal(app.ExitFailure))
+				Expect(stdout.String()).To(ContainSubstring("FAIL    output-file"))
+			})
+		})
+	})
+
+	Describe("import", func() {
+		It("adopts the application, its service principal and role assignments", func() {
+			output, err := sim.Execute(context.Background(), []string{"ad", "app", "create", "--display-name", "other-app"})
+			Expect(err).NotTo(HaveOccurred())
+			var application struct {
+				AppId string `json:"appId"`
+			}
+			Expect(json.Unmarshal([]byte(output), &application)).To(Succeed())
+			_, err = sim.Execute(context.Background(), []string{"ad", "sp", "create", "--id", application.AppId})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = sim.Execute(context.Background(), []string{"role", "assignment", "create", "--role", "Reader", "--assignee", application.AppId})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(run("import", application.AppId, "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK), stderr.String())
+			Expect(stderr.String()).To(ContainSubstring("Imported application other-app with 1 role assignments."))
+
+			Expect(run("show", "other-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+			var principal struct {
+				AppId              string `json:"app_id"`
+				ServicePrincipalId string `json:"service_principal_id"`
+				Imported           bool   `json:"imported"`
+				RoleAssignments    []struct {
+					Role  string `json:"role"`
+					Scope string `json:"scope"`
+				} `json:"role_assignments"`
+			}
+			Expect(json.Unmarshal(stdout.Bytes(), &principal)).To(Succeed())
+			Expect(principal.AppId).To(Equal(application.AppId))
+			Expect(principal.ServicePrincipalId).NotTo(BeEmpty())
+			Expect(principal.Imported).To(BeTrue())
+			Expect(principal.RoleAssignments).To(HaveLen(1))
+			Expect(principal.RoleAssignments[0].Role).To(Equal("Reader"))
+			Expect(principal.RoleAssignments[0].Scope).To(Equal("/subscriptions/" + simulator.SubscriptionId))
+		})
+
+		Context("when the application does not exist", func() {
+			It("refuses it and records nothing", func() {
+				Expect(run("import", "no-such-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("no-such-app"))
+
+				Expect(run("list", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+				Expect(stdout.String()).NotTo(ContainSubstring("no-such-app"))
+			})
+		})
+	})
+
+	Describe("rotate", func() {
+		keyIds := func() []string {
+			output, err := sim.Execute(context.Background(), []string{"ad", "app", "list"})
+			Expect(err).NotTo(HaveOccurred())
+
+			var applications []struct {
+				PasswordCredentials []struct {
+					KeyId string `json:"keyId"`
+				} `json:"passwordCredentials"`
+			}
+			Expect(json.Unmarshal([]byte(output), &applications)).To(Succeed())
+			Expect(applications).To(HaveLen(1))
+
+			var ids []string
+			for _, c := range applications[0].PasswordCredentials {
+				ids = append(ids, c.KeyId)
+			}
+			return ids
+		}
+
+		BeforeEach(func() {
+			Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars")...)).To(Equal(app.ExitOK))
+		})
+
+		It("replaces the client secret and rewrites the credentials", func() {
+			old := keyIds()
+			before, err := fs.ReadFile("creds.tfvars")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(run("rotate", "some-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+
+			Expect(keyIds()).To(HaveLen(1))
+			Expect(keyIds()).NotTo(ContainElement(old[0]))
+			after, err := fs.ReadFile("creds.tfvars")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(after).NotTo(Equal(before))
+		})
+
+		Context("when a sink fails", func() {
+			It("keeps the old client secret until a second rotate writes the new one", func() {
+				old := keyIds()
+				before, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+
+				fs.WriteFileCall.Returns.Error = errors.New("disk full")
+				Expect(run("rotate", "some-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitFailure))
+				Expect(stderr.String()).To(ContainSubstring("disk full"))
+				Expect(stderr.String()).To(ContainSubstring("The old client secret still works."))
+
+				Expect(keyIds()).To(HaveLen(2))
+				Expect(keyIds()).To(ContainElement(old[0]))
+				unchanged, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(unchanged).To(Equal(before))
+
+				fs.WriteFileCall.Returns.Error = nil
+				Expect(run("rotate", "some-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+
+				Expect(keyIds()).To(HaveLen(1))
+				Expect(keyIds()).NotTo(ContainElement(old[0]))
+				after, err := fs.ReadFile("creds.tfvars")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(after).NotTo(Equal(before))
+			})
+		})
+	})
+
+	Describe("destroy", func() {
+		It("deletes the principal and forgets it", func() {
+			Expect(run(files("--display-name", "some-app", "--credential-output-file", "creds.tfvars")...)).To(Equal(app.ExitOK))
+
+			Expect(run("destroy", "some-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitOK))
+			Expect(stderr.String()).To(ContainSubstring("The credentials written to file:creds.tfvars are no longer valid and can be removed."))
+
+			output, _ := sim.Execute(context.Background(), []string{"ad", "app", "list", "--display-name", "some-app"})
+			Expect(output).To(MatchJSON("[]"))
+			output, _ = sim.Execute(context.Background(), []string{"role", "assignment", "list", "--all"})
+			Expect(output).NotTo(ContainSubstring("Contributor"))
+
+			Expect(run("show", "some-app", "--state", filepath.Join(dir, "state.json"))).To(Equal(app.ExitFailure))
+		})
+	})
+})
+
+// executorFunc lets a test intercept the commands sent to the simulator.
+type executorFunc func(ctx context.Context, args []string) (string, error)
+
+func (f executorFunc) Execute(ctx context.Context, args []string) (string, error) {
+	return f(ctx, args)
+}
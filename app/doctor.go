@@ -0,0 +1,269 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+)
+
+// tokenFreshness is how long the access token must still be valid for a run
+// not to warn about it.
+const tokenFreshness = 10 * time.Minute
+
+// Statuses of a check.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+type doctorArgs struct {
+	Account              string `short:"a" long:"account"                description:"Your account id or name. Defaults to the default account."`
+	Cloud                string `          long:"cloud"                  description:"Azure cloud to use. Defaults to the active cloud of the azure-cli."`
+	Scope                string `          long:"scope"                  description:"Scope of the role assignments. Defaults to the subscription of the account."`
+	CredentialOutputFile string `short:"c" long:"credential-output-file" description:"Credential output file the run will write."                             default:"creds.tfvars"`
+	Format               string `          long:"format"                 description:"Format of the results."                 choice:"text" choice:"json" default:"text"`
+
+	cliArgs
+}
+
+// check is the outcome of one of the checks of doctor.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// doctor checks everything a run needs without creating anything, and prints
+// the results as a checklist or as json. A check that cannot run because an
+// earlier one failed is skipped.
+func (i *invocation) doctor(ctx context.Context, arguments []string) error {
+	var d doctorArgs
+	err := i.parse("az-automation doctor", "Options", &d, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(d.logArgs)
+
+	checks := i.diagnose(ctx, d)
+
+	if d.Format == "json" {
+		output, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(i.stdout, string(output))
+	} else {
+		writer := tabwriter.NewWriter(i.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "STATUS\tCHECK\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+		}
+		writer.Flush()
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d of %d checks failed.", failed, len(checks)))
+	}
+	return nil
+}
+
+func (i *invocation) diagnose(ctx context.Context, d doctorArgs) []check {
+	checks := []check{}
+	add := func(name, status, detail string) {
+		checks = append(checks, check{Name: name, Status: status, Detail: detail})
+	}
+	skip := func(reason string, names ...string) {
+		for _, name := range names {
+			add(name, checkSkip, reason)
+		}
+	}
+
+	// The output file is checked first, as it does not need the azure-cli.
+	status, detail := writable(d.CredentialOutputFile)
+	output := check{Name: "output-file", Status: status, Detail: detail}
+
+	_, azure, done, err := i.backend(d.cliArgs, defaultCommandTimeout, 0)
+	var version az.CLIVersion
+	if err == nil {
+		defer done()
+		version, err = azure.Version(ctx)
+	}
+	if err == nil {
+		status, detail := versionStatus(version)
+		add("azure-cli", status, detail)
+	} else {
+		add("azure-cli", checkFail, err.Error())
+		skip("The azure-cli is not usable.", "cloud", "login", "access-token", "subscription", "directory-role", "role-assignment")
+		return append(checks, output)
+	}
+
+	// The doctor only reads the cloud, since making it active would change the
+	// configuration of the azure-cli.
+	cloud, err := azure.ShowCloud(ctx, d.Cloud)
+	if err != nil {
+		add("cloud", checkFail, err.Error())
+		skip("The cloud is not usable.", "login", "access-token", "subscription", "directory-role", "role-assignment")
+		return append(checks, output)
+	}
+	if !cloud.IsActive {
+		add("cloud", checkWarn, fmt.Sprintf("The %s cloud is registered but not active. A run makes it active while it runs, but the doctor leaves the active cloud alone.", cloud.Name))
+		skip(fmt.Sprintf("Run 'az cloud set --name %s' first to check the %s cloud.", cloud.Name, cloud.Name), "login", "access-token", "subscription", "directory-role", "role-assignment")
+		return append(checks, output)
+	}
+	add("cloud", checkPass, fmt.Sprintf("Using the %s cloud.", cloud.Name))
+
+	account, err := azure.LoggedIn(ctx, d.Account)
+	if err != nil {
+		add("login", checkFail, err.Error())
+		skip("Not logged in.", "access-token", "subscription", "directory-role", "role-assignment")
+		return append(checks, output)
+	}
+	add("login", checkPass, fmt.Sprintf("Logged in as %s to %s (%s).", account.User.Name, account.Name, account.Id))
+	azure = azure.WithSubscription(account.Id)
+
+	expiry, err := azure.AccessTokenExpiry(ctx, account.Id)
+	switch {
+	case err != nil:
+		add("access-token", checkFail, fmt.Sprintf("Please log in to the azure-cli again: %s", err))
+	case expiry.Sub(i.Clock.Now()) < tokenFreshness:
+		add("access-token", checkWarn, fmt.Sprintf("The access token expires at %s.", expiry.Format(time.RFC3339)))
+	default:
+		add("access-token", checkPass, fmt.Sprintf("The access token expires at %s.", expiry.Format(time.RFC3339)))
+	}
+
+	switch account.State {
+	case "Enabled":
+		add("subscription", checkPass, "The subscription is Enabled.")
+	case "Warned":
+		add("subscription", checkWarn, "The subscription is Warned and will be disabled unless it is paid for.")
+	default:
+		add("subscription", checkFail, fmt.Sprintf("The subscription is %s.", account.State))
+	}
+
+	if err := version.Supports(az.FeatureRest); err != nil {
+		add("directory-role", checkWarn, fmt.Sprintf("The directory roles could not be checked: %s", err))
+	} else {
+		status, detail = directoryRole(ctx, azure, account, cloud)
+		add("directory-role", status, detail)
+	}
+
+	scope := d.Scope
+	if scope == "" {
+		scope = fmt.Sprintf("/subscriptions/%s", account.Id)
+	}
+	status, detail = roleAssignmentWriter(ctx, azure, account, scope)
+	add("role-assignment", status, detail)
+
+	return append(checks, output)
+}
+
+// versionStatus passes an azure-cli that supports every feature, and warns
+// about the features an older one does not.
+func versionStatus(version az.CLIVersion) (string, string) {
+	detail := fmt.Sprintf("Version %s", version.Core)
+	var extensions []string
+	for name, v := range version.Extensions {
+		extensions = append(extensions, fmt.Sprintf("%s %s", name, v))
+	}
+	sort.Strings(extensions)
+	if len(extensions) > 0 {
+		detail = fmt.Sprintf("%s with the extensions %s", detail, strings.Join(extensions, ", "))
+	}
+	detail += "."
+
+	status := checkPass
+	for _, feature := range []az.Feature{az.FeatureRest, az.FeatureMicrosoftGraph, az.FeatureFederatedCredentials} {
+		if err := version.Supports(feature); err != nil {
+			status = checkWarn
+			detail = fmt.Sprintf("%s %s", detail, err)
+		}
+	}
+	return status, detail
+}
+
+// directoryRole checks whether the signed-in user may register applications,
+// through a directory role or because any user of the tenant may.
+func directoryRole(ctx context.Context, azure *az.Az, account az.Account, cloud az.Cloud) (string, string) {
+	if account.User.Type != "user" {
+		return checkWarn, fmt.Sprintf("The directory roles of the %s %s cannot be checked.", account.User.Type, account.User.Name)
+	}
+
+	roles, err := azure.DirectoryRoles(ctx, cloud.Endpoints.MicrosoftGraphResourceId)
+	if err != nil {
+		return checkWarn, fmt.Sprintf("The directory roles could not be checked: %s", err)
+	}
+	if role, ok := az.HasRole(roles, az.ApplicationCreatorRoles); ok {
+		return checkPass, fmt.Sprintf("%s may register applications as %s.", account.User.Name, role)
+	}
+
+	allowed, err := azure.UsersCanCreateApplications(ctx, cloud.Endpoints.MicrosoftGraphResourceId)
+	if err != nil {
+		return checkWarn, fmt.Sprintf("%s has no directory role that may register applications, and whether users may could not be checked: %s", account.User.Name, err)
+	}
+	if allowed {
+		return checkPass, "Users of the tenant may register applications."
+	}
+	return checkFail, fmt.Sprintf("%s has none of the directory roles %s, and users of the tenant may not register applications.", account.User.Name, strings.Join(az.ApplicationCreatorRoles, ", "))
+}
+
+// roleAssignmentWriter checks whether the signed-in user has a role that may
+// assign roles at the scope.
+func roleAssignmentWriter(ctx context.Context, azure *az.Az, account az.Account, scope string) (string, string) {
+	assignments, err := azure.RoleAssignmentsAt(ctx, account.User.Name, scope)
+	if err != nil {
+		return checkWarn, fmt.Sprintf("The role assignments at %s could not be checked: %s", scope, err)
+	}
+
+	var names []string
+	for _, assignment := range assignments {
+		names = append(names, assignment.RoleDefinitionName)
+	}
+	if role, ok := az.HasRole(names, az.RoleAssignmentWriterRoles); ok {
+		return checkPass, fmt.Sprintf("%s may assign roles at %s as %s.", account.User.Name, scope, role)
+	}
+	return checkFail, fmt.Sprintf("%s has none of the roles %s at %s.", account.User.Name, strings.Join(az.RoleAssignmentWriterRoles, ", "), scope)
+}
+
+// writable checks that the output file can be created in its directory, by
+// creating and removing a temporary file there. It is always checked on the
+// local filesystem.
+func writable(path string) (string, string) {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return checkFail, fmt.Sprintf("The directory of %s does not exist.", path)
+	}
+	if !info.IsDir() {
+		return checkFail, fmt.Sprintf("%s is not a directory.", dir)
+	}
+
+	probe, err := ioutil.TempFile(dir, ".az-automation-doctor")
+	if err != nil {
+		return checkFail, fmt.Sprintf("%s cannot be written: %s", path, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if _, err := os.Stat(path); err == nil {
+		return checkWarn, fmt.Sprintf("%s already exists and will be overwritten.", path)
+	}
+	return checkPass, fmt.Sprintf("%s can be written.", path)
+}
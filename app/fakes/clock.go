@@ -0,0 +1,45 @@
+package fakes
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock struct {
+	mutex sync.Mutex
+
+	NowCall struct {
+		CallCount int
+		Returns   struct {
+			Time time.Time
+		}
+	}
+
+	AfterCall struct {
+		CallCount int
+		Receives  struct {
+			Duration time.Duration
+		}
+	}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.NowCall.CallCount++
+	return c.NowCall.Returns.Time
+}
+
+// After fires right away, so that nothing waits on the fake clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.AfterCall.CallCount++
+	c.AfterCall.Receives.Duration = d
+
+	ch := make(chan time.Time, 1)
+	ch <- c.NowCall.Returns.Time.Add(d)
+	return ch
+}
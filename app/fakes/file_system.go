@@ -0,0 +1,54 @@
+package fakes
+
+import (
+	"os"
+	"sync"
+)
+
+// FileSystem keeps its files in memory.
+type FileSystem struct {
+	mutex sync.Mutex
+	files map[string][]byte
+	perms map[string]os.FileMode
+
+	WriteFileCall struct {
+		Returns struct {
+			Error error
+		}
+	}
+}
+
+func (f *FileSystem) ReadFile(name string) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, ok := f.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte{}, data...), nil
+}
+
+func (f *FileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.WriteFileCall.Returns.Error != nil {
+		return f.WriteFileCall.Returns.Error
+	}
+
+	if f.files == nil {
+		f.files = map[string][]byte{}
+		f.perms = map[string]os.FileMode{}
+	}
+	f.files[name] = append([]byte{}, data...)
+	f.perms[name] = perm
+	return nil
+}
+
+func (f *FileSystem) Perm(name string) os.FileMode {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.perms[name]
+}
@@ -0,0 +1,269 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/encryption"
+	"github.com/genevieve/az-automation/store"
+)
+
+type args struct {
+	DisplayName          string `required:"true" short:"d" long:"display-name"           description:"Display name for application. Must be unique. Can be a template, e.g. {{slug .Subscription}}-terraform."`
+	IdentifierUri        string `                short:"i" long:"identifier-uri"         description:"Must be unique and on a verified domain, or auto to use api://<app id>."                 default:"auto"`
+	CredentialOutputFile string `required:"true" short:"c" long:"credential-output-file" description:"Must be unique."                                                      default:"creds.tfvars"`
+
+	options
+}
+
+type batchArgs struct {
+	File      string  `required:"true" short:"f" long:"file" description:"CSV or JSON file of the principals to create."`
+	Workers   int     `                          long:"workers"    description:"Number of principals to create at a time."                                          default:"4"`
+	RateLimit float64 `                          long:"rate-limit" description:"Maximum azure-cli commands started per second by all workers, or 0 for no limit." default:"5"`
+
+	options
+}
+
+type options struct {
+	Account string `short:"a" long:"account" description:"Your account id or name. Defaults to the default account. Use 'az account list' to see your accounts."`
+
+	cliArgs
+
+	State          string        `long:"state"           description:"State file of the principals created by az-automation."                                                     default:"az-automation.state.json"`
+	Journal        string        `long:"journal"         description:"Append the outcome of each step to this file, to finish an interrupted run with 'az-automation resume'."     default:"az-automation.journal"`
+	Timeout        time.Duration `long:"timeout"         description:"Give up after this long, e.g. 30m, and delete the application and its role assignments if they were created. Defaults to no timeout."`
+	CommandTimeout time.Duration `long:"command-timeout" description:"Give up on a single azure-cli command after this long."                                                       default:"5m"`
+
+	Cloud string   `long:"cloud" description:"Azure cloud to use, e.g. AzureUSGovernment, AzureChinaCloud or a registered custom cloud. Defaults to the active cloud of the azure-cli."`
+	Roles []string `long:"role"  description:"Role to assign to the service principal. Can be repeated."                                                                         default:"Contributor"`
+	Scope string   `long:"scope" description:"Scope of the role assignments. Defaults to the subscription of the account."`
+
+	OnCollision string `long:"on-collision" description:"What to do when the display name is taken: fail, or append a random or sequential suffix." choice:"fail" choice:"random" choice:"sequential" default:"fail"`
+
+	SkipPermissionCheck bool `long:"skip-permission-check" description:"Do not check that you may register applications and assign the roles before creating anything, e.g. when a custom role allows it."`
+
+	CredentialOutputFormat string            `long:"credential-output-format" description:"Format of the credential output file." choice:"tfvars" choice:"kubernetes-secret" choice:"azure-json" choice:"sdk-auth" default:"tfvars"`
+	KubernetesSecretName   string            `long:"kubernetes-secret-name"   description:"Name of the kubernetes secret."                                                                   default:"azure-credentials"`
+	KubernetesNamespace    string            `long:"kubernetes-namespace"     description:"Namespace of the kubernetes secret."`
+	KubernetesLabels       map[string]string `long:"kubernetes-label"         description:"Label the kubernetes secret, e.g. team:platform. Can be repeated."`
+	ResourceGroup          string            `long:"resource-group"           description:"Resource group of the cluster for the azure-json format."`
+	Location               string            `long:"location"                 description:"Location of the cluster for the azure-json format."`
+	EncryptTo              []string          `long:"encrypt-to"               description:"Encrypt the credential output file to an age or ssh public key. Can be repeated."`
+	EncryptToFile          []string          `long:"encrypt-to-file"          description:"Encrypt the credential output file to the public keys in a file, one per line. Can be repeated."`
+
+	FederatedPreset   string `long:"federated-preset"   description:"Create a federated credential instead of a client secret using a preset issuer: github, gitlab or kubernetes."`
+	FederatedIssuer   string `long:"federated-issuer"   description:"OIDC issuer of the federated credential. Required for kubernetes or without a preset."`
+	FederatedSubject  string `long:"federated-subject"  description:"Subject of the federated credential. With the kubernetes preset, <namespace>/<service-account>."`
+	FederatedAudience string `long:"federated-audience" description:"Audience of the federated credential."                                                          default:"api://AzureADTokenExchange"`
+	FederatedName     string `long:"federated-name"     description:"Name of the federated credential on the application."                                           default:"az-automation"`
+
+	Sinks           []string `long:"sink"             description:"Where to write the credentials. Can be repeated."    choice:"file" choice:"key-vault" choice:"vault" choice:"credhub" default:"file"`
+	CredentialYears int      `long:"credential-years" description:"Number of years until the client secret expires." default:"1"`
+
+	KeyVaultName          string            `long:"key-vault-name"           description:"Name of the key vault to write the credentials to."`
+	KeyVaultResourceGroup string            `long:"key-vault-resource-group" description:"Create the key vault in this resource group if it does not exist."`
+	KeyVaultLocation      string            `long:"key-vault-location"       description:"Location of the key vault when it is created."`
+	KeyVaultContentType   string            `long:"key-vault-content-type"   description:"Content type of the key vault secrets."                                          default:"text/plain"`
+	KeyVaultSecretNames   map[string]string `long:"key-vault-secret-name"    description:"Override a secret name, e.g. client_secret:my-client-secret. Can be repeated."`
+	KeyVaultTags          map[string]string `long:"key-vault-tag"            description:"Tag the key vault secrets, e.g. team:platform. Can be repeated."`
+
+	VaultAddress    string `long:"vault-address"     description:"Address of the vault server. Defaults to $VAULT_ADDR. The token is read from $VAULT_TOKEN."`
+	VaultNamespace  string `long:"vault-namespace"   description:"Vault enterprise namespace. Defaults to $VAULT_NAMESPACE."`
+	VaultMount      string `long:"vault-mount"       description:"Mount of the kv version 2 secrets engine."                         default:"secret"`
+	VaultPath       string `long:"vault-path"        description:"Path of the vault secret to write the credentials to."`
+	VaultCACert     string `long:"vault-ca-cert"     description:"CA certificate to verify the vault server with. Defaults to $VAULT_CACERT."`
+	VaultSkipVerify bool   `long:"vault-skip-verify" description:"Skip verification of the vault server certificate. Defaults to $VAULT_SKIP_VERIFY."`
+
+	CredHubServer     string `long:"credhub-server"      description:"Address of the credhub server. Defaults to $CREDHUB_SERVER. The client is read from $CREDHUB_CLIENT and $CREDHUB_SECRET."`
+	CredHubName       string `long:"credhub-name"        description:"Name of the credhub credential to write the credentials to."`
+	CredHubCACert     string `long:"credhub-ca-cert"     description:"CA certificate to verify the credhub and uaa servers with. Defaults to $CREDHUB_CA_CERT."`
+	CredHubSkipVerify bool   `long:"credhub-skip-verify" description:"Skip verification of the credhub and uaa server certificates."`
+}
+
+type resumeArgs struct {
+	Journal string `short:"j" long:"journal" description:"Journal of the runs to resume."        default:"az-automation.journal"`
+	Workers int    `          long:"workers" description:"Number of principals to resume at a time." default:"4"`
+
+	cliArgs
+}
+
+type logArgs struct {
+	LogFormat string `   long:"log-format" description:"Format of the logs written to stderr." choice:"text" choice:"json" default:"text"`
+	Quiet     bool   `short:"q" long:"quiet"      description:"Only log warnings and errors."`
+	Verbose   bool   `short:"v" long:"verbose"    description:"Also log debug messages, including every azure-cli command."`
+}
+
+type cliArgs struct {
+	Backend                   string        `long:"backend"                      description:"Run against the azure-cli, or a simulated tenant held in memory for demos and practice." choice:"azure-cli" choice:"simulated" default:"azure-cli"`
+	SimulatedReplicationDelay time.Duration `long:"simulated-replication-delay"  description:"How long a simulated service principal takes to become visible to role assignments." default:"10s"`
+	SimulatedCallsPerSecond   float64       `long:"simulated-calls-per-second"   description:"Throttle the simulated tenant beyond this many calls per second. Defaults to no throttling."`
+	SimulatedVersion          string        `long:"simulated-version"            description:"Version of the azure-cli the simulated tenant behaves like. Before 2.37.0 its az ad commands speak Azure AD Graph. Defaults to a recent version."`
+	AzureConfigDir            string        `long:"azure-config-dir"             description:"Run the azure-cli with this config directory instead of the one in AZURE_CONFIG_DIR or ~/.azure, so that its default subscription, cloud and token cache are left alone. Log in to it first with 'AZURE_CONFIG_DIR=<dir> az login'."`
+	TraceFile                 string        `long:"trace-file" description:"Append every azure-cli command, with secrets redacted, and its full output to this file."`
+	Record                    string        `long:"record"     description:"Record every azure-cli command, with secrets redacted, to this cassette."`
+	Replay                    string        `long:"replay"     description:"Serve the azure-cli commands from this cassette instead of running the azure-cli."`
+
+	logArgs
+}
+
+type decryptArgs struct {
+	Identity string `required:"true" short:"i" long:"identity" description:"Age identity file or ssh private key to decrypt with."`
+	Output   string `short:"o" long:"output" description:"Write the decrypted credentials to this file instead of stdout."`
+	Args     struct {
+		File string `required:"true" positional-arg-name:"file"`
+	} `positional-args:"true"`
+}
+
+type format interface {
+	Render(credentials az.Credentials) ([]byte, error)
+}
+
+// validator is a format or sink that can check its configuration before
+// anything is created.
+type validator interface {
+	Validate() error
+}
+
+type sink interface {
+	Write(ctx context.Context, credentials az.Credentials) error
+}
+
+// fromEnv fills in the options that default to environment variables.
+func (o *options) fromEnv(env map[string]string) {
+	defaults := map[*string]string{
+		&o.VaultAddress:   "VAULT_ADDR",
+		&o.VaultNamespace: "VAULT_NAMESPACE",
+		&o.VaultCACert:    "VAULT_CACERT",
+		&o.CredHubServer:  "CREDHUB_SERVER",
+		&o.CredHubCACert:  "CREDHUB_CA_CERT",
+	}
+	for option, name := range defaults {
+		if *option == "" {
+			*option = env[name]
+		}
+	}
+
+	if !o.VaultSkipVerify {
+		o.VaultSkipVerify, _ = strconv.ParseBool(env["VAULT_SKIP_VERIFY"])
+	}
+}
+
+func (o options) federated() bool {
+	return o.FederatedPreset != "" || o.FederatedIssuer != "" || o.FederatedSubject != ""
+}
+
+func (o options) format() format {
+	switch o.CredentialOutputFormat {
+	case "kubernetes-secret":
+		return az.KubernetesSecret{
+			Name:      o.KubernetesSecretName,
+			Namespace: o.KubernetesNamespace,
+			Labels:    o.KubernetesLabels,
+		}
+	case "azure-json":
+		return az.AzureJSON{
+			ResourceGroup: o.ResourceGroup,
+			Location:      o.Location,
+		}
+	case "sdk-auth":
+		return az.SDKAuth{}
+	default:
+		return az.Tfvars{}
+	}
+}
+
+func (o options) encrypted() bool {
+	return len(o.EncryptTo) > 0 || len(o.EncryptToFile) > 0
+}
+
+// outputs describes where the sinks write the credentials to.
+func (o options) outputs(credentialOutputFile string) []string {
+	var outputs []string
+	for _, s := range o.Sinks {
+		switch s {
+		case "file":
+			outputs = append(outputs, fmt.Sprintf("file:%s", credentialOutputFile))
+		case "key-vault":
+			outputs = append(outputs, fmt.Sprintf("key-vault:%s", o.KeyVaultName))
+		case "vault":
+			outputs = append(outputs, fmt.Sprintf("vault:%s/%s", strings.Trim(o.VaultMount, "/"), strings.Trim(o.VaultPath, "/")))
+		case "credhub":
+			outputs = append(outputs, fmt.Sprintf("credhub:%s", o.CredHubName))
+		}
+	}
+	return outputs
+}
+
+func (o options) sinks(cli Executor, fs FileSystem, logger *az.Logger, env map[string]string, credentialOutputFile string) ([]sink, error) {
+	var sinks []sink
+	for _, s := range o.Sinks {
+		switch s {
+		case "file":
+			var f format = o.format()
+			if v, ok := f.(validator); ok {
+				err := v.Validate()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if o.encrypted() {
+				recipients, err := encryption.ParseRecipients(o.EncryptTo, o.EncryptToFile)
+				if err != nil {
+					return nil, err
+				}
+				f = encryption.NewFormat(f, recipients)
+			}
+			sinks = append(sinks, az.NewFile(credentialOutputFile, f, fs, logger))
+		case "key-vault":
+			if o.KeyVaultName == "" {
+				return nil, errors.New("Please provide a --key-vault-name to use the key-vault sink.")
+			}
+			sinks = append(sinks, az.NewKeyVault(cli, logger, az.KeyVaultConfig{
+				Name:          o.KeyVaultName,
+				ResourceGroup: o.KeyVaultResourceGroup,
+				Location:      o.KeyVaultLocation,
+				ContentType:   o.KeyVaultContentType,
+				SecretNames:   o.KeyVaultSecretNames,
+				Tags:          o.KeyVaultTags,
+			}))
+		case "vault":
+			if o.VaultPath == "" {
+				return nil, errors.New("Please provide a --vault-path to use the vault sink.")
+			}
+			sinks = append(sinks, store.NewVault(store.VaultConfig{
+				Address:   o.VaultAddress,
+				Token:     env["VAULT_TOKEN"],
+				Namespace: o.VaultNamespace,
+				Mount:     o.VaultMount,
+				Path:      o.VaultPath,
+				TLS:       store.TLSConfig{CACertFile: o.VaultCACert, InsecureSkipVerify: o.VaultSkipVerify},
+			}, logger))
+		case "credhub":
+			if o.CredHubName == "" {
+				return nil, errors.New("Please provide a --credhub-name to use the credhub sink.")
+			}
+			sinks = append(sinks, store.NewCredHub(store.CredHubConfig{
+				Server:       o.CredHubServer,
+				Client:       env["CREDHUB_CLIENT"],
+				ClientSecret: env["CREDHUB_SECRET"],
+				Name:         o.CredHubName,
+				TLS:          store.TLSConfig{CACertFile: o.CredHubCACert, InsecureSkipVerify: o.CredHubSkipVerify},
+			}, logger))
+		}
+	}
+
+	for _, s := range sinks {
+		if v, ok := s.(validator); ok {
+			err := v.Validate()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return sinks, nil
+}
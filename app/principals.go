@@ -0,0 +1,452 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/journal"
+	"github.com/genevieve/az-automation/state"
+)
+
+// defaultCommandTimeout is used by the commands that manage principals from
+// the state file when the principal has no options of its own.
+const defaultCommandTimeout = 5 * time.Minute
+
+type stateArgs struct {
+	State string `long:"state" description:"State file of the principals created by az-automation." default:"az-automation.state.json"`
+
+	cliArgs
+}
+
+type principalArgs struct {
+	stateArgs
+	Args struct {
+		Principal string `required:"true" positional-arg-name:"app-id-or-display-name"`
+	} `positional-args:"true"`
+}
+
+type importArgs struct {
+	stateArgs
+	Account string `short:"a" long:"account" description:"Account id or name the application's roles were assigned in. Defaults to the default account."`
+	Cloud   string `long:"cloud" description:"Azure cloud of the application. Defaults to the active cloud of the azure-cli."`
+	Args    struct {
+		Application string `required:"true" positional-arg-name:"app-id"`
+	} `positional-args:"true"`
+}
+
+// listPrincipals prints a table of the principals in the state file.
+func (i *invocation) listPrincipals(arguments []string) error {
+	var s stateArgs
+	err := i.parse("az-automation list", "Options", &s, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(s.logArgs)
+
+	st, err := state.Open(s.State)
+	if err != nil {
+		return err
+	}
+	principals := st.Principals()
+	st.Close()
+
+	writer := tabwriter.NewWriter(i.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DISPLAY NAME\tAPP ID\tTENANT\tSECRET EXPIRES\tOUTPUTS")
+	for _, p := range principals {
+		expires := ""
+		for _, c := range p.Credentials {
+			if c.ExpiresOn > expires {
+				expires = c.ExpiresOn
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", p.DisplayName, p.AppId, p.TenantId, expires, strings.Join(p.Outputs, ", "))
+	}
+	writer.Flush()
+	return nil
+}
+
+// showPrincipal prints everything the state file records about a principal.
+func (i *invocation) showPrincipal(arguments []string) error {
+	var p principalArgs
+	err := i.parse("az-automation show", "Options", &p, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(p.logArgs)
+
+	st, err := state.Open(p.State)
+	if err != nil {
+		return err
+	}
+	principal, err := st.Find(p.Args.Principal)
+	st.Close()
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(principal, "", "  ")
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling principal json: %s", err))
+	}
+	fmt.Fprintln(i.stdout, string(output))
+	return nil
+}
+
+// destroyPrincipal deletes the role assignments and application of a
+// principal and forgets it. The credentials it was written to are left for
+// the caller to remove.
+func (i *invocation) destroyPrincipal(ctx context.Context, arguments []string) error {
+	var p principalArgs
+	err := i.parse("az-automation destroy", "Options", &p, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(p.logArgs)
+
+	st, err := state.Open(p.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	principal, err := st.Find(p.Args.Principal)
+	if err != nil {
+		return err
+	}
+
+	_, azure, done, err := i.setup(ctx, p.cliArgs, defaultCommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	_, restore, err := azure.SelectCloud(ctx, principal.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	for _, assignment := range principal.RoleAssignments {
+		if assignment.Id == "" {
+			continue
+		}
+
+		err = azure.DeleteRoleAssignment(ctx, assignment.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = azure.DeleteApplication(ctx, principal.AppId)
+	if err != nil {
+		return err
+	}
+
+	err = st.Remove(principal.AppId)
+	if err != nil {
+		return err
+	}
+
+	for _, output := range principal.Outputs {
+		i.logger.Warn(fmt.Sprintf("The credentials written to %s are no longer valid and can be removed.", output), az.F("app_id", principal.AppId))
+	}
+	return nil
+}
+
+// rotatePrincipal replaces the client secret of a principal and writes the
+// new credentials to the outputs it was created with. The old secrets keep
+// working until the new one has been written, and each step is recorded in
+// the journal of the principal so that a rotate that failed part way is
+// finished by running it again.
+func (i *invocation) rotatePrincipal(ctx context.Context, arguments []string) error {
+	var p principalArgs
+	err := i.parse("az-automation rotate", "Options", &p, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(p.logArgs)
+
+	st, err := state.Open(p.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	principal, err := st.Find(p.Args.Principal)
+	if err != nil {
+		return err
+	}
+
+	if principal.Run == nil {
+		return errors.New(fmt.Sprintf("The principal %s was imported, so it is not known where to write a new client secret to.", principal.DisplayName))
+	}
+
+	var rn run
+	err = json.Unmarshal(principal.Run, &rn)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Unmarshalling run of %s from the state file: %s", principal.DisplayName, err))
+	}
+
+	if rn.Options.federated() {
+		return errors.New(fmt.Sprintf("The principal %s uses a federated credential and has no client secret to rotate.", principal.DisplayName))
+	}
+
+	ctx, cancel := runContext(ctx, rn.Options.Timeout)
+	defer cancel()
+
+	cli, azure, done, err := i.setup(ctx, p.cliArgs, rn.Options.CommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cloud, restore, err := azure.SelectCloud(ctx, rn.Options.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	account, err := azure.LoggedIn(ctx, rn.Account)
+	if err != nil {
+		return err
+	}
+
+	sinks, err := rn.Options.sinks(cli, i.FS, i.logger, i.env, rn.Principal.CredentialOutputFile)
+	if err != nil {
+		return err
+	}
+
+	rotation, err := pendingRotation(rn.Options.Journal, rn.Principal.DisplayName, principal.AppId)
+	if err != nil {
+		return err
+	}
+
+	j, err := journal.Open(rn.Options.Journal)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	record := func(entry journal.Entry) error {
+		entry.Principal = rn.Principal.DisplayName
+		return j.Record(entry)
+	}
+
+	_, current, err := applicationDetails(ctx, azure, principal.AppId)
+	if err != nil {
+		return err
+	}
+
+	// The new secret is added next to the old ones, which are only deleted
+	// once it has been written to every sink. A secret is only ever kept in
+	// memory, so one added by an earlier rotate that stopped before writing
+	// it everywhere is replaced as well.
+	if rotation == nil || !rotation.CredentialsWritten {
+		rotation = &journal.Rotation{ClientId: principal.AppId, ObsoleteKeyIds: keyIds(current)}
+		err = record(journal.Entry{Step: journal.StepRotationStarted, ClientId: principal.AppId, KeyIds: rotation.ObsoleteKeyIds})
+		if err != nil {
+			return err
+		}
+
+		clientSecret := azure.GeneratePassword()
+		expiresOn := i.Clock.Now().AddDate(rn.Options.CredentialYears, 0, 0)
+
+		clientSecret, err = azure.AppendPassword(ctx, principal.AppId, clientSecret, expiresOn)
+		if err != nil {
+			return err
+		}
+
+		_, current, err = applicationDetails(ctx, azure, principal.AppId)
+		if err != nil {
+			return err
+		}
+		for _, keyId := range keyIds(current) {
+			if !contains(rotation.ObsoleteKeyIds, keyId) {
+				rotation.KeyId = keyId
+			}
+		}
+
+		err = record(journal.Entry{Step: journal.StepRotationSecret, KeyId: rotation.KeyId, ExpiresOn: optionalTime(expiresOn)})
+		if err != nil {
+			return err
+		}
+
+		credentials := az.Credentials{
+			DisplayName:    principal.DisplayName,
+			SubscriptionId: account.Id,
+			TenantId:       account.TenantId,
+			ClientId:       principal.AppId,
+			ClientSecret:   clientSecret,
+			ExpiresOn:      expiresOn,
+			Cloud:          cloud,
+		}
+
+		for _, s := range sinks {
+			err = s.Write(ctx, credentials)
+			if err != nil {
+				return errors.New(fmt.Sprintf("%s\nThe old client secret still works. Run rotate again to finish.", err))
+			}
+		}
+
+		err = record(journal.Entry{Step: journal.StepRotationCredentials, Sinks: rn.Options.Sinks})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, keyId := range rotation.ObsoleteKeyIds {
+		if !contains(keyIds(current), keyId) {
+			continue
+		}
+
+		err = azure.DeletePassword(ctx, principal.AppId, keyId)
+		if err != nil {
+			return err
+		}
+	}
+
+	principal.ObjectId, principal.Credentials, err = applicationDetails(ctx, azure, principal.AppId)
+	if err != nil {
+		return err
+	}
+
+	err = st.Put(principal)
+	if err != nil {
+		return err
+	}
+
+	err = record(journal.Entry{Step: journal.StepRotationCompleted, ClientId: principal.AppId})
+	if err != nil {
+		return err
+	}
+
+	i.logger.Info("Rotated client secret.", az.F("step", "rotate"), az.F("app_id", principal.AppId))
+	return nil
+}
+
+// pendingRotation returns the rotation of the client secret of the principal
+// that an earlier rotate did not finish, if the journal has one.
+func pendingRotation(path, name, clientId string) (*journal.Rotation, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	entries, err := journal.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, progress := range journal.Replay(entries) {
+		if progress.Principal == name && progress.Rotation != nil && progress.Rotation.ClientId == clientId {
+			return progress.Rotation, nil
+		}
+	}
+	return nil, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func keyIds(credentials []state.Credential) []string {
+	var ids []string
+	for _, c := range credentials {
+		ids = append(ids, c.KeyId)
+	}
+	return ids
+}
+
+// importPrincipal adopts an application that was not created by
+// az-automation into the state file, with its service principal and role
+// assignments.
+func (i *invocation) importPrincipal(ctx context.Context, arguments []string) error {
+	var im importArgs
+	err := i.parse("az-automation import", "Options", &im, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(im.logArgs)
+
+	st, err := state.Open(im.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	_, azure, done, err := i.setup(ctx, im.cliArgs, defaultCommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cloud, restore, err := azure.SelectCloud(ctx, im.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	account, err := azure.LoggedIn(ctx, im.Account)
+	if err != nil {
+		return err
+	}
+	azure = azure.WithSubscription(account.Id)
+
+	application, err := azure.ShowApplication(ctx, im.Args.Application)
+	if err != nil {
+		return err
+	}
+
+	principal := state.Principal{
+		DisplayName: application.DisplayName,
+		AppId:       application.AppId,
+		ObjectId:    application.Id,
+		TenantId:    account.TenantId,
+		Cloud:       cloud.Name,
+		Imported:    true,
+	}
+
+	for _, c := range application.PasswordCredentials {
+		principal.Credentials = append(principal.Credentials, state.Credential{KeyId: c.KeyId, ExpiresOn: c.EndDate})
+	}
+
+	servicePrincipal, err := azure.ShowServicePrincipal(ctx, application.AppId)
+	if err != nil {
+		return err
+	}
+	principal.ServicePrincipalId = servicePrincipal.Id
+
+	assignments, err := azure.ListRoleAssignments(ctx, application.AppId)
+	if err != nil {
+		return err
+	}
+
+	for _, assignment := range assignments {
+		principal.RoleAssignments = append(principal.RoleAssignments, state.RoleAssignment{
+			Id:    assignment.Id,
+			Role:  assignment.RoleDefinitionName,
+			Scope: assignment.Scope,
+		})
+	}
+	principal.Subscriptions = subscriptions(account.Id, principal.RoleAssignments)
+
+	err = st.Put(principal)
+	if err != nil {
+		return err
+	}
+
+	i.logger.Info(fmt.Sprintf("Imported application %s with %d role assignments.", principal.DisplayName, len(principal.RoleAssignments)), az.F("step", "import"), az.F("app_id", principal.AppId))
+	return nil
+}
@@ -0,0 +1,848 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/batch"
+	"github.com/genevieve/az-automation/journal"
+	"github.com/genevieve/az-automation/state"
+	"github.com/genevieve/az-automation/wizard"
+)
+
+// cleanupTimeout bounds the deletion of the application after a run was
+// interrupted.
+const cleanupTimeout = time.Minute
+
+// provisionOne creates a single principal. When required flags are missing
+// and stdin is a terminal, a wizard asks for them instead.
+func (i *invocation) provisionOne(ctx context.Context, arguments []string) error {
+	var a args
+	err := i.parse("az-automation", "Application Options", &a, arguments)
+
+	interactive := false
+	if err != nil {
+		if usage, ok := err.(usageError); !ok || !usage.missing || !i.Terminal {
+			return err
+		}
+		interactive = true
+	}
+	a.fromEnv(i.env)
+	i.startLogging(a.logArgs)
+
+	ctx, cancel := runContext(ctx, a.Timeout)
+	defer cancel()
+
+	cli, azure, done, err := i.setup(ctx, a.cliArgs, a.CommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cloud, restore, err := azure.SelectCloud(ctx, a.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if interactive {
+		answers, err := wizard.New(i.Stdin, i.stdout, azure).Run(ctx, wizard.Answers{
+			Account:                a.Account,
+			DisplayName:            a.DisplayName,
+			IdentifierUri:          a.IdentifierUri,
+			Roles:                  a.Roles,
+			Scope:                  a.Scope,
+			CredentialOutputFormat: a.CredentialOutputFormat,
+			CredentialOutputFile:   a.CredentialOutputFile,
+			ResourceGroup:          a.ResourceGroup,
+			Location:               a.Location,
+		})
+		if err != nil {
+			return err
+		}
+
+		a.Account = answers.Account
+		a.DisplayName = answers.DisplayName
+		a.IdentifierUri = answers.IdentifierUri
+		a.Roles = answers.Roles
+		a.Scope = answers.Scope
+		a.CredentialOutputFormat = answers.CredentialOutputFormat
+		a.CredentialOutputFile = answers.CredentialOutputFile
+		a.ResourceGroup = answers.ResourceGroup
+		a.Location = answers.Location
+	}
+
+	account, err := azure.LoggedIn(ctx, a.Account)
+	if err != nil {
+		return err
+	}
+
+	j, err := journal.Open(a.Journal)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	st, err := state.Open(a.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	p := i.provisioner(cli, account, cloud, a.options)
+	p.journal = j
+	p.state = st
+
+	principal := batch.Principal{
+		DisplayName:          a.DisplayName,
+		IdentifierUri:        a.IdentifierUri,
+		CredentialOutputFile: a.CredentialOutputFile,
+	}
+
+	err = p.preflight(ctx, []batch.Principal{principal})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.provision(ctx, principal)
+	return err
+}
+
+// batch provisions the principals of a batch file concurrently, sharing the
+// rest of the options between them, and prints a summary at the end.
+func (i *invocation) batch(ctx context.Context, arguments []string) error {
+	var b batchArgs
+	err := i.parse("az-automation batch", "Batch Options", &b, arguments)
+	if err != nil {
+		return err
+	}
+	b.fromEnv(i.env)
+	i.startLogging(b.logArgs)
+
+	for _, s := range b.Sinks {
+		if s != "file" {
+			return usageError{message: fmt.Sprintf("The %s sink would write every principal to the same place. Please use the file sink in a batch.", s)}
+		}
+	}
+
+	contents, err := i.FS.ReadFile(b.File)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Opening batch file: %s", err))
+	}
+
+	principals, err := batch.Parse(b.File, contents)
+	if err != nil {
+		return err
+	}
+
+	for _, principal := range principals {
+		if principal.CredentialOutputFile == "" {
+			return errors.New(fmt.Sprintf("Please provide a credential_output_file for %s in the batch file.", principal.DisplayName))
+		}
+	}
+
+	ctx, cancel := runContext(ctx, b.Timeout)
+	defer cancel()
+
+	cli, azure, done, err := i.setup(ctx, b.cliArgs, b.CommandTimeout, b.RateLimit)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cloud, restore, err := azure.SelectCloud(ctx, b.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	account, err := azure.LoggedIn(ctx, b.Account)
+	if err != nil {
+		return err
+	}
+
+	j, err := journal.Open(b.Journal)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	st, err := state.Open(b.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	p := i.provisioner(cli, account, cloud, b.options)
+	p.batch = true
+	p.journal = j
+	p.state = st
+
+	err = p.preflight(ctx, principals)
+	if err != nil {
+		return err
+	}
+
+	results := batch.Run(ctx, principals, b.Workers, p.provision)
+	return i.summarize(results)
+}
+
+// resume finishes the runs in the journal that did not complete, with the
+// account and options they were started with.
+func (i *invocation) resume(ctx context.Context, arguments []string) error {
+	var r resumeArgs
+	err := i.parse("az-automation resume", "Resume Options", &r, arguments)
+	if err != nil {
+		return err
+	}
+	i.startLogging(r.logArgs)
+
+	entries, err := journal.Read(r.Journal)
+	if err != nil {
+		return err
+	}
+
+	var (
+		runs       = map[string]run{}
+		principals []batch.Principal
+		progress   = map[string]journal.Progress{}
+	)
+	for _, state := range journal.Replay(entries) {
+		if state.Completed || state.Run == nil {
+			continue
+		}
+
+		var rn run
+		err = json.Unmarshal(state.Run, &rn)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Unmarshalling run of %s from the journal: %s", state.Principal, err))
+		}
+		rn.Options.Journal = r.Journal
+
+		runs[state.Principal] = rn
+		principals = append(principals, rn.Principal)
+		progress[state.Principal] = state
+	}
+
+	if len(principals) == 0 {
+		return errors.New(fmt.Sprintf("Every run in the journal %s is complete, so there is nothing to resume.", r.Journal))
+	}
+
+	first := runs[principals[0].DisplayName]
+	for _, rn := range runs {
+		if rn.Options.Cloud != first.Options.Cloud {
+			return errors.New("The runs in the journal use different clouds. Please resume them from separate journals.")
+		}
+	}
+
+	ctx, cancel := runContext(ctx, first.Options.Timeout)
+	defer cancel()
+
+	cli, azure, done, err := i.setup(ctx, r.cliArgs, first.Options.CommandTimeout, 0)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cloud, restore, err := azure.SelectCloud(ctx, first.Options.Cloud)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	j, err := journal.Open(r.Journal)
+	if err != nil {
+		return err
+	}
+	defer j.Close()
+
+	st, err := state.Open(first.Options.State)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	results := batch.Run(ctx, principals, r.Workers, func(ctx context.Context, principal batch.Principal) (string, error) {
+		rn := runs[principal.DisplayName]
+
+		account, err := azure.LoggedIn(ctx, rn.Account)
+		if err != nil {
+			return "", err
+		}
+
+		p := i.provisioner(cli, account, cloud, rn.Options)
+		p.batch = len(principals) > 1 || rn.Batch
+		p.journal = j
+		p.state = st
+		p.progress = progress
+
+		err = p.preflight(ctx, []batch.Principal{principal})
+		if err != nil {
+			return "", err
+		}
+		return p.provision(ctx, principal)
+	})
+	return i.summarize(results)
+}
+
+// summarize prints a summary of the results and fails if any principal did.
+func (i *invocation) summarize(results []batch.Result) error {
+	fmt.Fprintf(i.stdout, "\n%s", batch.Summary(results))
+
+	failed := batch.Failed(results)
+	if failed > 0 {
+		return errors.New(fmt.Sprintf("%d of %d principals failed.", failed, len(results)))
+	}
+	return nil
+}
+
+func (i *invocation) provisioner(cli Executor, account az.Account, cloud az.Cloud, o options) provisioner {
+	return provisioner{
+		cli:     cli,
+		clock:   i.Clock,
+		fs:      i.FS,
+		env:     i.env,
+		logger:  i.logger,
+		version: i.version,
+		account: account,
+		cloud:   cloud,
+		options: o,
+	}
+}
+
+type provisioner struct {
+	cli      Executor
+	clock    Clock
+	fs       FileSystem
+	env      map[string]string
+	logger   *az.Logger
+	version  az.CLIVersion
+	account  az.Account
+	cloud    az.Cloud
+	options  options
+	batch    bool
+	journal  *journal.Journal
+	state    *state.State
+	progress map[string]journal.Progress
+}
+
+// run is recorded in the journal when a principal is started, so that it
+// can be resumed with the same account and options.
+type run struct {
+	Account   string          `json:"account"`
+	Principal batch.Principal `json:"principal"`
+	Options   options         `json:"options"`
+	Batch     bool            `json:"batch"`
+}
+
+// assignments returns the roles to assign to the principal and their scope.
+// Roles and a scope given for the principal take the place of the options.
+func (p provisioner) assignments(principal batch.Principal) ([]string, string) {
+	roles := principal.Roles
+	if len(roles) == 0 {
+		roles = p.options.Roles
+	}
+
+	scope := principal.Scope
+	if scope == "" {
+		scope = p.options.Scope
+	}
+	if scope == "" {
+		scope = fmt.Sprintf("/subscriptions/%s", p.account.Id)
+	}
+
+	return roles, scope
+}
+
+// preflight checks that the azure-cli supports the features of the options,
+// and that the signed-in user may register the applications and assign the
+// roles of the principals that still need them, so that nothing is created
+// when a later step is bound to fail. A check that cannot be made, such as
+// the directory roles of a service principal, is only logged.
+func (p provisioner) preflight(ctx context.Context, principals []batch.Principal) error {
+	if p.options.federated() {
+		err := p.version.Supports(az.FeatureFederatedCredentials)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.options.SkipPermissionCheck {
+		return nil
+	}
+	azure := az.NewAz(p.cli, p.logger).WithDialect(p.version.Dialect()).WithSubscription(p.account.Id)
+
+	createsApplication := false
+	var scopes []string
+	roles := map[string][]string{}
+	for _, principal := range principals {
+		progress := p.progress[principal.DisplayName]
+		if progress.ClientId == "" {
+			createsApplication = true
+		}
+
+		principalRoles, scope := p.assignments(principal)
+		for _, role := range principalRoles {
+			if progress.Assigned(role, scope) {
+				continue
+			}
+			if _, ok := roles[scope]; !ok {
+				scopes = append(scopes, scope)
+			}
+			roles[scope] = append(roles[scope], role)
+		}
+	}
+
+	var missing []string
+	check := func(status, detail string) {
+		switch status {
+		case checkFail:
+			missing = append(missing, detail)
+		case checkWarn:
+			p.logger.Warn(detail, az.F("step", "check-permissions"))
+		}
+	}
+
+	if createsApplication {
+		if err := p.version.Supports(az.FeatureRest); err != nil {
+			check(checkWarn, fmt.Sprintf("The directory roles could not be checked: %s", err))
+		} else {
+			check(directoryRole(ctx, azure, p.account, p.cloud))
+		}
+	}
+	for _, scope := range scopes {
+		status, detail := roleAssignmentWriter(ctx, azure, p.account, scope)
+		if status == checkFail {
+			detail = fmt.Sprintf("%s They are needed to assign %s.", detail, strings.Join(unique(roles[scope]), ", "))
+		}
+		check(status, detail)
+	}
+
+	if len(missing) > 0 {
+		return errors.New(fmt.Sprintf("Nothing was created, as you are missing permissions:\n  - %s\nUse --skip-permission-check if a custom role grants them.", strings.Join(missing, "\n  - ")))
+	}
+
+	p.logger.Info("Checked you may create the principals.", az.F("step", "check-permissions"))
+	return nil
+}
+
+func unique(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// provision creates the application and service principal, assigns the roles
+// and writes the credentials to the sinks, recording each step in the
+// journal. Steps the journal shows as done for the principal are skipped.
+// Once the application has been created its client id is returned, also when
+// a later step fails. When the context is done before the end the
+// application is deleted again.
+func (p provisioner) provision(ctx context.Context, principal batch.Principal) (clientId string, err error) {
+	start := p.clock.Now()
+	logger := p.logger
+	if p.batch {
+		logger = logger.With(az.F("principal", principal.DisplayName))
+	}
+	azure := az.NewAz(p.cli, logger).WithDialect(p.version.Dialect()).WithSubscription(p.account.Id)
+	progress := p.progress[principal.DisplayName]
+
+	roles, scope := p.assignments(principal)
+
+	sinks, err := p.options.sinks(p.cli, p.fs, logger, p.env, principal.CredentialOutputFile)
+	if err != nil {
+		return "", err
+	}
+
+	var federatedCredential az.FederatedCredential
+	if p.options.federated() {
+		federatedCredential, err = az.NewFederatedCredential(p.options.FederatedName, p.options.FederatedPreset, p.options.FederatedIssuer, p.options.FederatedSubject, p.options.FederatedAudience)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var (
+		displayName   = progress.DisplayName
+		identifierUri = progress.IdentifierUri
+		clientSecret  string
+		expiresOn     = progress.ExpiresOn
+	)
+	clientId = progress.ClientId
+
+	// The assignments of the roles, including those made by an earlier run,
+	// which are deleted along with the application when the run stops.
+	var assignments []state.RoleAssignment
+	for _, role := range roles {
+		if progress.Assigned(role, scope) {
+			assignments = append(assignments, state.RoleAssignment{Id: progress.AssignmentId(role, scope), Role: role, Scope: scope})
+		}
+	}
+
+	// The application is deleted as soon as it is known, also when setting
+	// its secret is what the run stopped at.
+	defer func() {
+		if clientId != "" && err != nil && ctx.Err() != nil {
+			cleanupErr := p.cleanup(azure, clientId, assignments)
+			if cleanupErr != nil {
+				err = errors.New(fmt.Sprintf("%s\nCleaning up: %s", err, cleanupErr))
+				return
+			}
+			recordErr := p.record(principal, journal.Entry{Step: journal.StepDeleted, ClientId: clientId})
+			if recordErr == nil && p.state != nil {
+				recordErr = p.state.Remove(clientId)
+			}
+			if recordErr != nil {
+				err = errors.New(fmt.Sprintf("%s\n%s", err, recordErr))
+			}
+		}
+	}()
+
+	if clientId == "" {
+		displayName, identifierUri, err = p.names(ctx, azure, principal)
+		if err != nil {
+			return "", err
+		}
+
+		err = p.record(principal, journal.Entry{Step: journal.StepStarted, Run: p.run(principal)})
+		if err != nil {
+			return "", err
+		}
+
+		if !p.options.federated() {
+			clientSecret = azure.GeneratePassword()
+			expiresOn = p.clock.Now().AddDate(p.options.CredentialYears, 0, 0)
+		}
+
+		// With Microsoft Graph the secret is set once the application exists,
+		// so an application is recorded even when its secret failed; a resume
+		// replaces the secret.
+		var createErr error
+		clientId, clientSecret, createErr = azure.CreateApplication(ctx, clientSecret, displayName, identifierUri, expiresOn)
+		if clientId == "" {
+			return "", createErr
+		}
+
+		err = p.record(principal, journal.Entry{
+			Step:          journal.StepApplication,
+			DisplayName:   displayName,
+			IdentifierUri: identifierUri,
+			ClientId:      clientId,
+			ExpiresOn:     optionalTime(expiresOn),
+		})
+		if err != nil {
+			return clientId, err
+		}
+
+		err = p.remember(state.Principal{
+			DisplayName:   displayName,
+			AppId:         clientId,
+			TenantId:      p.account.TenantId,
+			Cloud:         p.cloud.Name,
+			Subscriptions: []string{p.account.Id},
+			Outputs:       p.options.outputs(principal.CredentialOutputFile),
+			Run:           p.run(principal),
+		})
+		if err != nil {
+			return clientId, err
+		}
+
+		if createErr != nil {
+			return clientId, createErr
+		}
+	} else {
+		logger.Info(fmt.Sprintf("Resuming application %s.", displayName), az.F("step", "resume"), az.F("app_id", clientId))
+	}
+
+	if identifierUri == "" && !progress.IdentifierUriSet {
+		err = azure.SetIdentifierUri(ctx, clientId, fmt.Sprintf("api://%s", clientId))
+		if err != nil {
+			return clientId, err
+		}
+
+		err = p.record(principal, journal.Entry{Step: journal.StepIdentifierUri, IdentifierUri: fmt.Sprintf("api://%s", clientId)})
+		if err != nil {
+			return clientId, err
+		}
+	}
+
+	if p.options.federated() && !progress.FederatedCredential {
+		err = azure.CreateFederatedCredential(ctx, clientId, federatedCredential)
+		if err != nil {
+			return clientId, err
+		}
+
+		err = p.record(principal, journal.Entry{Step: journal.StepFederatedCredential})
+		if err != nil {
+			return clientId, err
+		}
+	}
+
+	servicePrincipalId := progress.ServicePrincipalId
+	if servicePrincipalId == "" {
+		servicePrincipalId, err = azure.CreateServicePrincipal(ctx, clientId)
+		if err != nil {
+			return clientId, err
+		}
+
+		err = p.record(principal, journal.Entry{Step: journal.StepServicePrincipal, ObjectId: servicePrincipalId})
+		if err != nil {
+			return clientId, err
+		}
+
+		select {
+		case <-p.clock.After(30 * time.Second):
+		case <-ctx.Done():
+			return clientId, errors.New("Interrupted while waiting for the service principal.")
+		}
+	}
+
+	for _, role := range roles {
+		if progress.Assigned(role, scope) {
+			continue
+		}
+
+		id, err := azure.AssignRole(ctx, clientId, role, scope)
+		if err != nil {
+			return clientId, err
+		}
+		assignments = append(assignments, state.RoleAssignment{Id: id, Role: role, Scope: scope})
+
+		err = p.record(principal, journal.Entry{Step: journal.StepRoleAssignment, Role: role, Scope: scope, RoleAssignmentId: id})
+		if err != nil {
+			return clientId, err
+		}
+	}
+
+	if !progress.CredentialsWritten {
+		// A secret is only ever kept in memory, so one that was not written
+		// to every sink before the run stopped has to be replaced.
+		if clientSecret == "" && !p.options.federated() {
+			clientSecret = azure.GeneratePassword()
+			expiresOn = p.clock.Now().AddDate(p.options.CredentialYears, 0, 0)
+
+			clientSecret, err = azure.ResetPassword(ctx, clientId, clientSecret, expiresOn)
+			if err != nil {
+				return clientId, err
+			}
+
+			err = p.record(principal, journal.Entry{Step: journal.StepSecret, ExpiresOn: optionalTime(expiresOn)})
+			if err != nil {
+				return clientId, err
+			}
+		}
+
+		id, tenantId := azure.GetSubscriptionAndTenantId(p.account)
+		credentials := az.Credentials{
+			DisplayName:      displayName,
+			SubscriptionId:   id,
+			TenantId:         tenantId,
+			ClientId:         clientId,
+			ClientSecret:     clientSecret,
+			FederatedSubject: federatedCredential.Subject,
+			ExpiresOn:        expiresOn,
+			Cloud:            p.cloud,
+		}
+
+		for _, s := range sinks {
+			err = s.Write(ctx, credentials)
+			if err != nil {
+				return clientId, err
+			}
+		}
+
+		err = p.record(principal, journal.Entry{Step: journal.StepCredentials, Sinks: p.options.Sinks})
+		if err != nil {
+			return clientId, err
+		}
+	}
+
+	saved := state.Principal{
+		DisplayName:        displayName,
+		AppId:              clientId,
+		ServicePrincipalId: servicePrincipalId,
+		TenantId:           p.account.TenantId,
+		Cloud:              p.cloud.Name,
+		Subscriptions:      subscriptions(p.account.Id, assignments),
+		RoleAssignments:    assignments,
+		Outputs:            p.options.outputs(principal.CredentialOutputFile),
+		Run:                p.run(principal),
+	}
+	if p.state != nil {
+		saved.ObjectId, saved.Credentials, err = applicationDetails(ctx, azure, clientId)
+		if err != nil {
+			return clientId, err
+		}
+	}
+
+	err = p.remember(saved)
+	if err != nil {
+		return clientId, err
+	}
+
+	err = p.record(principal, journal.Entry{Step: journal.StepCompleted, ClientId: clientId})
+	if err != nil {
+		return clientId, err
+	}
+
+	logger.Info("Provisioned principal.", az.F("step", "provision"), az.F("app_id", clientId), az.F("duration", p.clock.Now().Sub(start)))
+	return clientId, nil
+}
+
+// names renders the display name and identifier uri of the principal and
+// checks they are free. An automatic identifier uri is returned empty.
+func (p provisioner) names(ctx context.Context, azure *az.Az, principal batch.Principal) (string, string, error) {
+	variables := az.NewNameVariables(p.account, p.clock.Now())
+
+	displayName, err := az.RenderName(principal.DisplayName, variables)
+	if err != nil {
+		return "", "", err
+	}
+
+	displayName, err = azure.AvailableDisplayName(ctx, displayName, p.options.OnCollision)
+	if err != nil {
+		return "", "", err
+	}
+	variables.DisplayName = displayName
+
+	identifierUri := principal.IdentifierUri
+	if identifierUri == "" {
+		identifierUri = az.AutoIdentifierUri
+	}
+
+	identifierUri, err = az.RenderName(identifierUri, variables)
+	if err != nil {
+		return "", "", err
+	}
+
+	if identifierUri == az.AutoIdentifierUri {
+		return displayName, "", nil
+	}
+
+	err = p.version.Supports(az.FeatureRest)
+	if err != nil {
+		return "", "", errors.New(fmt.Sprintf("Checking the --identifier-uri is on a verified domain: %s", err))
+	}
+
+	domains, err := azure.VerifiedDomains(ctx, p.cloud.Endpoints.MicrosoftGraphResourceId)
+	if err != nil {
+		return "", "", errors.New(fmt.Sprintf("Checking the --identifier-uri is on a verified domain: %s", err))
+	}
+
+	err = az.ValidateIdentifierUri(identifierUri, p.account.TenantId, domains)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = azure.IdentifierUriExists(ctx, identifierUri)
+	if err != nil {
+		return "", "", err
+	}
+
+	return displayName, identifierUri, nil
+}
+
+func (p provisioner) run(principal batch.Principal) json.RawMessage {
+	r, _ := json.Marshal(run{
+		Account:   p.account.Id,
+		Principal: principal,
+		Options:   p.options,
+		Batch:     p.batch,
+	})
+	return r
+}
+
+// record appends the entry for the principal to the journal, if there is one.
+func (p provisioner) record(principal batch.Principal, entry journal.Entry) error {
+	if p.journal == nil {
+		return nil
+	}
+
+	entry.Principal = principal.DisplayName
+	return p.journal.Record(entry)
+}
+
+// remember puts the principal in the state file, if there is one.
+func (p provisioner) remember(principal state.Principal) error {
+	if p.state == nil {
+		return nil
+	}
+	return p.state.Put(principal)
+}
+
+// cleanup deletes the role assignments and application of a run that was
+// interrupted or timed out, as deleting the application leaves its role
+// assignments behind. It has a context of its own, since the one of the run
+// is done.
+func (p provisioner) cleanup(azure *az.Az, clientId string, assignments []state.RoleAssignment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	for _, assignment := range assignments {
+		if assignment.Id == "" {
+			continue
+		}
+
+		err := azure.DeleteRoleAssignment(ctx, assignment.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return azure.DeleteApplication(ctx, clientId)
+}
+
+// applicationDetails looks up the object id of the application and the key
+// ids and expiry of its client secrets.
+func applicationDetails(ctx context.Context, azure *az.Az, clientId string) (string, []state.Credential, error) {
+	application, err := azure.ShowApplication(ctx, clientId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var credentials []state.Credential
+	for _, c := range application.PasswordCredentials {
+		credentials = append(credentials, state.Credential{KeyId: c.KeyId, ExpiresOn: c.EndDate})
+	}
+
+	return application.Id, credentials, nil
+}
+
+// subscriptions returns the subscription of the account followed by the
+// others the role assignments are scoped to.
+func subscriptions(accountId string, assignments []state.RoleAssignment) []string {
+	ids := []string{accountId}
+	for _, assignment := range assignments {
+		id := state.SubscriptionOf(assignment.Scope)
+		if id == "" {
+			continue
+		}
+
+		seen := false
+		for _, existing := range ids {
+			seen = seen || strings.EqualFold(existing, id)
+		}
+		if !seen {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -1,42 +1,88 @@
 package az
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/google/uuid"
-	semver "github.com/hashicorp/go-version"
 )
 
 type Account struct {
-	Name     string `json:"name"`
-	Id       string `json:"id"`
-	TenantId string `json:"tenantId"`
+	Name      string      `json:"name"`
+	Id        string      `json:"id"`
+	TenantId  string      `json:"tenantId"`
+	State     string      `json:"state"`
+	IsDefault bool        `json:"isDefault"`
+	User      AccountUser `json:"user"`
+}
+
+type AccountUser struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
 type Application struct {
-	DisplayName string `json:"displayName"`
-	AppId       string `json:"appId"`
+	DisplayName         string               `json:"displayName"`
+	AppId               string               `json:"appId"`
+	Id                  string               `json:"id"`
+	ObjectId            string               `json:"objectId"`
+	IdentifierUris      []string             `json:"identifierUris"`
+	PasswordCredentials []PasswordCredential `json:"passwordCredentials"`
+}
+
+// PasswordCredential is a client secret of an application. Older versions of
+// the azure-cli return its expiry as endDate, newer ones as endDateTime.
+type PasswordCredential struct {
+	KeyId       string `json:"keyId"`
+	EndDate     string `json:"endDate"`
+	EndDateTime string `json:"endDateTime"`
 }
 
 type ServicePrincipal struct {
-	AppId string `json:"appId"`
+	AppId    string `json:"appId"`
+	Id       string `json:"id"`
+	ObjectId string `json:"objectId"`
+}
+
+type RoleAssignment struct {
+	Id                 string `json:"id"`
+	RoleDefinitionName string `json:"roleDefinitionName"`
+	Scope              string `json:"scope"`
+}
+
+type Credentials struct {
+	DisplayName      string
+	SubscriptionId   string
+	TenantId         string
+	ClientId         string
+	ClientSecret     string
+	FederatedSubject string
+	ExpiresOn        time.Time
+	Cloud            Cloud
 }
 
 type Az struct {
-	cli    cli
-	logger logger
+	cli          cli
+	logger       logger
+	dialect      Dialect
+	subscription string
 }
 
 type cli interface {
-	Execute(args []string) (string, error)
+	Execute(ctx context.Context, args []string) (string, error)
 }
 
 type logger interface {
-	Println(message string)
+	Debug(message string, fields ...Field)
+	Info(message string, fields ...Field)
+	Warn(message string, fields ...Field)
+	Error(message string, fields ...Field)
 }
 
 func NewAz(cli cli, logger logger) *Az {
@@ -46,150 +92,468 @@ func NewAz(cli cli, logger logger) *Az {
 	}
 }
 
-func (a Az) ValidVersion() error {
-	output, err := a.cli.Execute([]string{"-v"})
-	if err != nil {
-		return errors.New("Please install the azure-cli.")
-	}
+// WithSubscription returns a copy of a that runs the commands scoped to a
+// subscription, such as role assignments, in the subscription rather than in
+// that of the default account.
+func (a Az) WithSubscription(id string) *Az {
+	a.subscription = id
+	return &a
+}
+
+func (a Az) inSubscription(args []string) []string {
+	return inSubscription(args, a.subscription)
+}
 
-	regex := regexp.MustCompile(`\d+.\d+.\d+`)
-	v := regex.FindString(output)
+// inSubscription adds the subscription, if there is one, to the args.
+func inSubscription(args []string, subscription string) []string {
+	if subscription == "" {
+		return args
+	}
+	return append(args, "--subscription", subscription)
+}
 
-	curr, err := semver.NewVersion(v)
+// LoggedIn finds the account by id or name among the accounts of the
+// azure-cli, or the default account when no name is given. A name shared by
+// several subscriptions is rejected rather than guessed, as is an account in
+// another tenant than the default account, since the `az ad` commands always
+// run in the tenant of the default account.
+func (a Az) LoggedIn(ctx context.Context, accountName string) (Account, error) {
+	accounts, err := a.ListAccounts(ctx)
 	if err != nil {
-		return errors.New("The azure-cli version could not be parsed.")
+		return Account{}, err
 	}
 
-	min, _ := semver.NewVersion("2.0.0")
+	var candidates []Account
+	if accountName == "" {
+		for _, account := range accounts {
+			if account.IsDefault {
+				candidates = append(candidates, account)
+			}
+		}
+
+		if len(candidates) == 0 {
+			return Account{}, errors.New("There is no default account. Please provide an --account. Use 'az account list' to see your accounts.")
+		}
+	} else {
+		for _, account := range accounts {
+			if strings.EqualFold(account.Id, accountName) {
+				candidates = append(candidates, account)
+			}
+		}
+
+		if len(candidates) == 0 {
+			for _, account := range accounts {
+				if account.Name == accountName {
+					candidates = append(candidates, account)
+				}
+			}
+		}
+
+		if len(candidates) == 0 {
+			return Account{}, errors.New(fmt.Sprintf("The --account %s was not found. Use 'az account list' to see your accounts.", accountName))
+		}
+	}
 
-	if curr.LessThan(min) {
-		return errors.New("Please update the azure-cli to at least 2.0.0.")
+	if len(candidates) > 1 {
+		return Account{}, errors.New(fmt.Sprintf("The --account %s matches %d accounts. Please provide the id of one of them:\n\n%s",
+			accountName, len(candidates), accountTable(candidates)))
 	}
 
-	a.logger.Println("Checked version of azure-cli is above 2.0.0.")
-	return nil
+	for _, account := range accounts {
+		if account.IsDefault && !strings.EqualFold(account.TenantId, candidates[0].TenantId) {
+			return Account{}, errors.New(fmt.Sprintf("The --account %s is in tenant %s, but the azure-cli runs its directory commands in tenant %s of the default account. Please make it the default with 'az account set --subscription %s'.",
+				accountName, candidates[0].TenantId, account.TenantId, candidates[0].Id))
+		}
+	}
+
+	a.logger.Info("Checked you are logged in to the azure-cli.", F("step", "check-login"), F("subscription", candidates[0].Id))
+	return candidates[0], nil
 }
 
-func (a Az) LoggedIn(accountName string) (Account, error) {
-	account := Account{}
+func accountTable(accounts []Account) string {
+	buffer := bytes.NewBuffer([]byte{})
+
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tID\tTENANT\tSTATE")
+	for _, account := range accounts {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", account.Name, account.Id, account.TenantId, account.State)
+	}
+	writer.Flush()
+
+	return buffer.String()
+}
 
-	output, err := a.cli.Execute([]string{"account", "show", "-s", accountName})
+func (a Az) ListAccounts(ctx context.Context) ([]Account, error) {
+	output, err := a.cli.Execute(ctx, []string{"account", "list"})
 	if err != nil {
-		return account, errors.New("Please login to the azure-cli.")
+		return nil, errors.New("Please login to the azure-cli.")
 	}
 
-	err = json.Unmarshal([]byte(output), &account)
+	accounts := []Account{}
+	err = json.Unmarshal([]byte(output), &accounts)
 	if err != nil {
-		return account, errors.New(fmt.Sprintf("Unmarshalling account json: %s", err))
+		return nil, errors.New(fmt.Sprintf("Unmarshalling accounts json: %s", err))
 	}
 
-	a.logger.Println("Checked you are logged in to the azure-cli.")
-	return account, nil
+	if len(accounts) == 0 {
+		return nil, errors.New("Please login to the azure-cli.")
+	}
+
+	return accounts, nil
 }
 
 func (a Az) GetSubscriptionAndTenantId(account Account) (string, string) {
 	return account.Id, account.TenantId
 }
 
-func (a Az) AppExists(displayName string) error {
+func (a Az) AppExists(ctx context.Context, displayName string) error {
+	_, err := a.AvailableDisplayName(ctx, displayName, "")
+	return err
+}
+
+// AvailableDisplayName returns the display name if no application has it yet.
+// Otherwise, unless onCollision is random or sequential, the collision is an
+// error; random appends a short random suffix and sequential appends the
+// lowest free number starting from 2.
+func (a Az) AvailableDisplayName(ctx context.Context, displayName, onCollision string) (string, error) {
 	args := []string{
 		"ad", "app", "list",
 		"--display-name", displayName,
 	}
 
-	output, err := a.cli.Execute(args)
+	output, err := a.cli.Execute(ctx, args)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+		return "", errors.New(fmt.Sprintf("Running %+v: %s", args, output))
 	}
 
 	applications := []Application{}
 	err = json.Unmarshal([]byte(output), &applications)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Unmarshalling applications json: %s", err))
+		return "", errors.New(fmt.Sprintf("Unmarshalling applications json: %s", err))
 	}
 
-	if len(applications) > 0 {
-		return errors.New(fmt.Sprintf("The --display-name %s is taken by application with id %s.", displayName, applications[0].AppId))
+	// The azure-cli matches display names by prefix.
+	taken := map[string]Application{}
+	for _, application := range applications {
+		taken[strings.ToLower(application.DisplayName)] = application
 	}
 
-	a.logger.Println(fmt.Sprintf("Confirmed no application already exists with display name %s.", displayName))
-	return nil
+	application, ok := taken[strings.ToLower(displayName)]
+	if !ok {
+		a.logger.Info(fmt.Sprintf("Confirmed no application already exists with display name %s.", displayName), F("step", "check-display-name"))
+		return displayName, nil
+	}
+
+	var candidate string
+	switch onCollision {
+	case "random":
+		for {
+			candidate = fmt.Sprintf("%s-%s", displayName, uuid.Must(uuid.NewRandom()).String()[:6])
+			if _, ok := taken[strings.ToLower(candidate)]; !ok {
+				break
+			}
+		}
+	case "sequential":
+		for n := 2; ; n++ {
+			candidate = fmt.Sprintf("%s-%d", displayName, n)
+			if _, ok := taken[strings.ToLower(candidate)]; !ok {
+				break
+			}
+		}
+	default:
+		return "", errors.New(fmt.Sprintf("The --display-name %s is taken by application with id %s.", displayName, application.AppId))
+	}
+
+	a.logger.Warn(fmt.Sprintf("The display name %s is taken by application with id %s, using %s.", displayName, application.AppId, candidate), F("step", "check-display-name"), F("app_id", application.AppId))
+	return candidate, nil
 }
 
 func (a Az) GeneratePassword() string {
 	return uuid.Must(uuid.NewRandom()).String()
 }
 
-func (a Az) CreateApplication(password, displayName, identifierUri string) (string, error) {
-	createArgs := []string{
-		"ad", "app", "create",
-		"--display-name", displayName,
-		"--homepage", identifierUri,
-		"--identifier-uris", identifierUri,
+// CreateApplication creates the application and returns its client id and
+// client secret. Without a password it has no client secret. The password is
+// used when the azure-cli speaks Azure AD Graph; Microsoft Graph generates a
+// secret in its place. When that fails the client id is still returned.
+func (a Az) CreateApplication(ctx context.Context, password, displayName, identifierUri string, endDate time.Time) (string, string, error) {
+	createArgs, args := a.dialect.createApplicationArgs(password, displayName, identifierUri, endDate)
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return "", "", errors.New(fmt.Sprintf("Running %+v: %s", createArgs, output))
 	}
 
-	output, err := a.cli.Execute(append(createArgs, "--password", password))
+	application := Application{}
+	err = json.Unmarshal([]byte(output), &application)
 	if err != nil {
-		return "", errors.New(fmt.Sprintf("Running %+v: %s", createArgs, output))
+		return "", "", errors.New(fmt.Sprintf("Unmarshalling application json: %s", err))
+	}
+
+	a.logger.Info("Created application.", F("step", "create-application"), F("app_id", application.AppId))
+
+	if password == "" || a.dialect == AzureADGraph {
+		return application.AppId, password, nil
+	}
+
+	clientSecret, err := a.ResetPassword(ctx, application.AppId, password, endDate)
+	if err != nil {
+		return application.AppId, "", err
+	}
+	return application.AppId, clientSecret, nil
+}
+
+// ShowApplication returns the application with the app id, object id or
+// identifier uri. Older versions of the azure-cli return the object id as
+// objectId and the expiry of secrets as endDate, which are moved to Id and
+// EndDate.
+func (a Az) ShowApplication(ctx context.Context, id string) (Application, error) {
+	args := []string{
+		"ad", "app", "show",
+		"--id", id,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return Application{}, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
 	}
 
 	application := Application{}
 	err = json.Unmarshal([]byte(output), &application)
 	if err != nil {
-		return "", errors.New(fmt.Sprintf("Unmarshalling application json: %s", err))
+		return Application{}, errors.New(fmt.Sprintf("Unmarshalling application json: %s", err))
 	}
 
-	a.logger.Println("Created application.")
-	return application.AppId, nil
+	if application.Id == "" {
+		application.Id = application.ObjectId
+	}
+	for i, credential := range application.PasswordCredentials {
+		if credential.EndDate == "" {
+			application.PasswordCredentials[i].EndDate = credential.EndDateTime
+		}
+	}
+
+	return application, nil
 }
 
-func (a Az) CreateServicePrincipal(clientId string) error {
-	createArgs := []string{
-		"ad", "sp", "create",
+// ShowServicePrincipal returns the service principal of the application.
+func (a Az) ShowServicePrincipal(ctx context.Context, clientId string) (ServicePrincipal, error) {
+	args := []string{
+		"ad", "sp", "show",
 		"--id", clientId,
 	}
 
-	output, err := a.cli.Execute(createArgs)
+	output, err := a.cli.Execute(ctx, args)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Running %+v: %s", createArgs, output))
+		return ServicePrincipal{}, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
 	}
 
-	a.logger.Println("Created service principal.")
-	return nil
+	servicePrincipal := ServicePrincipal{}
+	err = json.Unmarshal([]byte(output), &servicePrincipal)
+	if err != nil {
+		return ServicePrincipal{}, errors.New(fmt.Sprintf("Unmarshalling service principal json: %s", err))
+	}
+
+	if servicePrincipal.Id == "" {
+		servicePrincipal.Id = servicePrincipal.ObjectId
+	}
+
+	return servicePrincipal, nil
 }
 
-func (a Az) AssignContributorRole(clientId string) error {
+// ListRoleAssignments returns the role assignments of the service principal
+// at any scope.
+func (a Az) ListRoleAssignments(ctx context.Context, clientId string) ([]RoleAssignment, error) {
 	args := []string{
-		"role", "assignment", "create",
-		"--role", "Contributor",
+		"role", "assignment", "list",
 		"--assignee", clientId,
+		"--all",
 	}
+	args = a.inSubscription(args)
 
-	output, err := a.cli.Execute(args)
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	assignments := []RoleAssignment{}
+	err = json.Unmarshal([]byte(output), &assignments)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unmarshalling role assignments json: %s", err))
+	}
+
+	return assignments, nil
+}
+
+func (a Az) DeleteRoleAssignment(ctx context.Context, id string) error {
+	args := []string{
+		"role", "assignment", "delete",
+		"--ids", id,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
 	}
 
-	a.logger.Println("Assigned contributor role to service principal.")
+	a.logger.Info(fmt.Sprintf("Deleted role assignment %s.", id), F("step", "delete-role-assignment"), F("role_assignment_id", id))
 	return nil
 }
 
-func (a *Az) WriteCredentials(id, tenantId, clientId, clientSecret, credentialOutputFile string) error {
-	creds := fmt.Sprintf(`subscription_id = "%s"
-tenant_id = "%s"
-client_id = "%s"
-client_secret = "%s"
-`,
-		id,
-		tenantId,
-		clientId,
-		clientSecret)
+// ResetPassword replaces the client secrets of the application, for when the
+// secret it was created with has been lost, and returns the new secret. It is
+// the password when the azure-cli speaks Azure AD Graph, and generated by
+// Microsoft Graph otherwise.
+func (a Az) ResetPassword(ctx context.Context, clientId, password string, endDate time.Time) (string, error) {
+	return a.credentialReset(ctx, clientId, password, endDate, false)
+}
+
+// AppendPassword adds a client secret to the application next to the ones it
+// has, so that they keep working until they are deleted, and returns it like
+// ResetPassword.
+func (a Az) AppendPassword(ctx context.Context, clientId, password string, endDate time.Time) (string, error) {
+	return a.credentialReset(ctx, clientId, password, endDate, true)
+}
+
+func (a Az) credentialReset(ctx context.Context, clientId, password string, endDate time.Time, keep bool) (string, error) {
+	resetArgs, args := a.dialect.resetPasswordArgs(clientId, password, endDate, keep)
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Running %+v: %s", resetArgs, output))
+	}
+
+	clientSecret, err := a.dialect.resetPassword(output, password)
+	if err != nil {
+		return "", err
+	}
+
+	if keep {
+		a.logger.Info("Added client secret to application.", F("step", "append-secret"), F("app_id", clientId))
+	} else {
+		a.logger.Info("Reset client secret of application.", F("step", "reset-secret"), F("app_id", clientId))
+	}
+	return clientSecret, nil
+}
+
+// DeletePassword deletes the client secret with the key id from the
+// application.
+func (a Az) DeletePassword(ctx context.Context, clientId, keyId string) error {
+	args := []string{
+		"ad", "app", "credential", "delete",
+		"--id", clientId,
+		"--key-id", keyId,
+	}
 
-	err := ioutil.WriteFile(credentialOutputFile, []byte(creds), 0600)
+	output, err := a.cli.Execute(ctx, args)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Writing credentials to output file: %s", err))
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
 	}
 
-	a.logger.Println(fmt.Sprintf("Wrote credentials to %s.", credentialOutputFile))
+	a.logger.Info(fmt.Sprintf("Deleted client secret %s.", keyId), F("step", "delete-secret"), F("app_id", clientId), F("key_id", keyId))
 	return nil
 }
+
+// DeleteApplication deletes the application along with its service principal
+// and credentials, to clean up after a run that was interrupted.
+func (a Az) DeleteApplication(ctx context.Context, clientId string) error {
+	args := []string{
+		"ad", "app", "delete",
+		"--id", clientId,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	a.logger.Info(fmt.Sprintf("Deleted application %s.", clientId), F("step", "delete-application"), F("app_id", clientId))
+	return nil
+}
+
+// CreateServicePrincipal creates the service principal of the application
+// and returns its object id.
+func (a Az) CreateServicePrincipal(ctx context.Context, clientId string) (string, error) {
+	createArgs := []string{
+		"ad", "sp", "create",
+		"--id", clientId,
+	}
+
+	output, err := a.cli.Execute(ctx, createArgs)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Running %+v: %s", createArgs, output))
+	}
+
+	servicePrincipal := ServicePrincipal{}
+	err = json.Unmarshal([]byte(output), &servicePrincipal)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unmarshalling service principal json: %s", err))
+	}
+
+	// Older versions of the azure-cli return the object id as objectId.
+	if servicePrincipal.Id == "" {
+		servicePrincipal.Id = servicePrincipal.ObjectId
+	}
+
+	a.logger.Info("Created service principal.", F("step", "create-service-principal"), F("app_id", clientId), F("object_id", servicePrincipal.Id))
+	return servicePrincipal.Id, nil
+}
+
+func (a Az) CreateFederatedCredential(ctx context.Context, clientId string, credential FederatedCredential) error {
+	parameters, err := json.Marshal(credential)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling federated credential json: %s", err))
+	}
+
+	args := []string{
+		"ad", "app", "federated-credential", "create",
+		"--id", clientId,
+		"--parameters", string(parameters),
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	a.logger.Info(fmt.Sprintf("Created federated credential for subject %s.", credential.Subject), F("step", "create-federated-credential"), F("app_id", clientId))
+	return nil
+}
+
+func (a Az) AssignContributorRole(ctx context.Context, clientId string) error {
+	_, err := a.AssignRole(ctx, clientId, "Contributor", "")
+	return err
+}
+
+// AssignRole assigns the role to the service principal at the scope, or at
+// the subscription of the azure-cli when no scope is given, and returns the
+// id of the role assignment.
+func (a Az) AssignRole(ctx context.Context, clientId, role, scope string) (string, error) {
+	args := []string{
+		"role", "assignment", "create",
+		"--role", role,
+		"--assignee", clientId,
+	}
+	if scope != "" {
+		args = append(args, "--scope", scope)
+	}
+	args = a.inSubscription(args)
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	assignment := RoleAssignment{}
+	err = json.Unmarshal([]byte(output), &assignment)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unmarshalling role assignment json: %s", err))
+	}
+
+	if scope == "" {
+		a.logger.Info(fmt.Sprintf("Assigned %s role to service principal.", strings.ToLower(role)), F("step", "assign-role"), F("app_id", clientId), F("role_assignment_id", assignment.Id))
+	} else {
+		a.logger.Info(fmt.Sprintf("Assigned %s role to service principal at %s.", strings.ToLower(role), scope), F("step", "assign-role"), F("app_id", clientId), F("role_assignment_id", assignment.Id))
+	}
+	return assignment.Id, nil
+}
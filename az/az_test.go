@@ -1,9 +1,9 @@
 package az_test
 
 import (
+	"context"
 	"errors"
-	"io/ioutil"
-	"os"
+	"time"
 
 	"github.com/genevieve/az-automation/az"
 	"github.com/genevieve/az-automation/az/fakes"
@@ -16,12 +16,11 @@ var _ = Describe("Az", func() {
 	var (
 		azure *az.Az
 
-		cli                  *fakes.CLI
-		logger               *fakes.Logger
-		account              string
-		displayName          string
-		identifierUri        string
-		credentialOutputFile string
+		cli           *fakes.CLI
+		logger        *fakes.Logger
+		account       string
+		displayName   string
+		identifierUri string
 	)
 
 	BeforeEach(func() {
@@ -30,7 +29,6 @@ var _ = Describe("Az", func() {
 		account = "some-account"
 		displayName = "some-display-name"
 		identifierUri = "http://some-identifier-uri"
-		credentialOutputFile = "some-credential-file"
 
 		azure = az.NewAz(cli, logger)
 	})
@@ -41,11 +39,11 @@ var _ = Describe("Az", func() {
 		})
 
 		It("checks the azure-cli is 2.0", func() {
-			err := azure.ValidVersion()
+			err := azure.ValidVersion(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"-v"}))
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Checked version of azure-cli is above 2.0.0."))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Checked version of azure-cli is above 2.0.0."))
 		})
 
 		Context("when this first execute call fails", func() {
@@ -54,7 +52,7 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.ValidVersion()
+				err := azure.ValidVersion(context.Background())
 				Expect(err).To(MatchError("Please install the azure-cli."))
 			})
 		})
@@ -65,7 +63,7 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.ValidVersion()
+				err := azure.ValidVersion(context.Background())
 				Expect(err).To(MatchError("The azure-cli version could not be parsed."))
 			})
 		})
@@ -76,7 +74,7 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.ValidVersion()
+				err := azure.ValidVersion(context.Background())
 				Expect(err).To(MatchError("Please update the azure-cli to at least 2.0.0."))
 			})
 		})
@@ -84,18 +82,88 @@ var _ = Describe("Az", func() {
 
 	Describe("LoggedIn", func() {
 		BeforeEach(func() {
-			cli.ExecuteCall.Returns.Output = `{"name": "some-account", "id": "some-id", "tenantId": "some-tenant-id"}`
+			cli.ExecuteCall.Returns.Output = `[
+				{"name": "some-account", "id": "some-id", "tenantId": "some-tenant-id", "state": "Enabled", "isDefault": false},
+				{"name": "other-account", "id": "other-id", "tenantId": "some-tenant-id", "state": "Enabled", "isDefault": true}
+			]`
 		})
 
 		It("checks the user is logged in", func() {
-			acc, err := azure.LoggedIn(account)
+			acc, err := azure.LoggedIn(context.Background(), account)
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "show", "-s", "some-account"}))
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "list"}))
 			Expect(acc.Name).To(Equal(account))
 			Expect(acc.Id).To(Equal("some-id"))
 			Expect(acc.TenantId).To(Equal("some-tenant-id"))
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Checked you are logged in to the azure-cli."))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Checked you are logged in to the azure-cli."))
+		})
+
+		It("finds the account by id", func() {
+			acc, err := azure.LoggedIn(context.Background(), "SOME-ID")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(acc.Name).To(Equal("some-account"))
+		})
+
+		Context("when no account is provided", func() {
+			It("uses the default account", func() {
+				acc, err := azure.LoggedIn(context.Background(), "")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(acc.Id).To(Equal("other-id"))
+			})
+
+			Context("and there is no default account", func() {
+				BeforeEach(func() {
+					cli.ExecuteCall.Returns.Output = `[{"name": "some-account", "id": "some-id", "isDefault": false}]`
+				})
+
+				It("returns a helpful error", func() {
+					_, err := azure.LoggedIn(context.Background(), "")
+					Expect(err).To(MatchError("There is no default account. Please provide an --account. Use 'az account list' to see your accounts."))
+				})
+			})
+		})
+
+		Context("when the account name is shared by several subscriptions", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[
+					{"name": "some-account", "id": "some-id", "tenantId": "some-tenant-id", "state": "Enabled"},
+					{"name": "some-account", "id": "another-id", "tenantId": "another-tenant-id", "state": "Disabled"}
+				]`
+			})
+
+			It("returns a table of the candidates", func() {
+				_, err := azure.LoggedIn(context.Background(), account)
+				Expect(err).To(MatchError(`The --account some-account matches 2 accounts. Please provide the id of one of them:
+
+NAME          ID          TENANT             STATE
+some-account  some-id     some-tenant-id     Enabled
+some-account  another-id  another-tenant-id  Disabled
+`))
+			})
+		})
+
+		Context("when the account is in another tenant than the default account", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[
+					{"name": "some-account", "id": "some-id", "tenantId": "some-tenant-id", "state": "Enabled", "isDefault": false},
+					{"name": "other-account", "id": "other-id", "tenantId": "other-tenant-id", "state": "Enabled", "isDefault": true}
+				]`
+			})
+
+			It("returns a helpful error", func() {
+				_, err := azure.LoggedIn(context.Background(), account)
+				Expect(err).To(MatchError("The --account some-account is in tenant some-tenant-id, but the azure-cli runs its directory commands in tenant other-tenant-id of the default account. Please make it the default with 'az account set --subscription some-id'."))
+			})
+		})
+
+		Context("when the account is not found", func() {
+			It("returns a helpful error", func() {
+				_, err := azure.LoggedIn(context.Background(), "banana")
+				Expect(err).To(MatchError("The --account banana was not found. Use 'az account list' to see your accounts."))
+			})
 		})
 
 		Context("when the cli returns an error", func() {
@@ -104,19 +172,61 @@ var _ = Describe("Az", func() {
 			})
 
 			It("checks the user is logged in", func() {
-				_, err := azure.LoggedIn(account)
+				_, err := azure.LoggedIn(context.Background(), account)
 				Expect(err).To(MatchError("Please login to the azure-cli."))
 			})
 		})
 
-		Context("when the account json is invalid", func() {
+		Context("when the accounts json is invalid", func() {
 			BeforeEach(func() {
 				cli.ExecuteCall.Returns.Output = `{$$$}`
 			})
 
 			It("returns a helpful error", func() {
-				_, err := azure.LoggedIn(account)
-				Expect(err).To(MatchError(ContainSubstring("Unmarshalling account json: ")))
+				_, err := azure.LoggedIn(context.Background(), account)
+				Expect(err).To(MatchError(ContainSubstring("Unmarshalling accounts json: ")))
+			})
+		})
+	})
+
+	Describe("ListAccounts", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `[{"name": "some-account", "id": "some-id", "tenantId": "some-tenant-id", "state": "Enabled", "isDefault": true}]`
+		})
+
+		It("returns the accounts", func() {
+			accounts, err := azure.ListAccounts(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "list"}))
+			Expect(accounts).To(Equal([]az.Account{{
+				Name:      "some-account",
+				Id:        "some-id",
+				TenantId:  "some-tenant-id",
+				State:     "Enabled",
+				IsDefault: true,
+			}}))
+		})
+
+		Context("when there are no accounts", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[]`
+			})
+
+			It("returns a helpful error", func() {
+				_, err := azure.ListAccounts(context.Background())
+				Expect(err).To(MatchError("Please login to the azure-cli."))
+			})
+		})
+
+		Context("when the accounts json is invalid", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[{$$$}]`
+			})
+
+			It("returns a helpful error", func() {
+				_, err := azure.ListAccounts(context.Background())
+				Expect(err).To(MatchError(ContainSubstring("Unmarshalling accounts json: ")))
 			})
 		})
 	})
@@ -142,11 +252,11 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns no error", func() {
-				err := azure.AppExists(displayName)
+				err := azure.AppExists(context.Background(), displayName)
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "list", "--display-name", displayName}))
-				Expect(logger.PrintlnCall.Receives.Message).To(Equal("Confirmed no application already exists with display name some-display-name."))
+				Expect(logger.InfoCall.Receives.Message).To(Equal("Confirmed no application already exists with display name some-display-name."))
 			})
 		})
 
@@ -156,7 +266,7 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.AppExists(displayName)
+				err := azure.AppExists(context.Background(), displayName)
 				Expect(err).To(MatchError("The --display-name some-display-name is taken by application with id 1234."))
 			})
 		})
@@ -168,7 +278,7 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.AppExists(displayName)
+				err := azure.AppExists(context.Background(), displayName)
 				Expect(err).To(MatchError("Running [ad app list --display-name some-display-name]: the error message"))
 			})
 		})
@@ -179,12 +289,62 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				err := azure.AppExists(displayName)
+				err := azure.AppExists(context.Background(), displayName)
 				Expect(err).To(MatchError(ContainSubstring("Unmarshalling applications json: ")))
 			})
 		})
 	})
 
+	Describe("AvailableDisplayName", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `[
+				{"displayName": "some-display-name", "appId": "1234"},
+				{"displayName": "some-display-name-2", "appId": "5678"},
+				{"displayName": "some-display-name-other", "appId": "9012"}
+			]`
+		})
+
+		Context("when the display name is free", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[{"displayName": "some-display-name-other", "appId": "9012"}]`
+			})
+
+			It("ignores applications that only share the prefix", func() {
+				name, err := azure.AvailableDisplayName(context.Background(), displayName, "fail")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(name).To(Equal(displayName))
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "list", "--display-name", displayName}))
+			})
+		})
+
+		Context("when a sequential suffix is requested", func() {
+			It("appends the lowest free number", func() {
+				name, err := azure.AvailableDisplayName(context.Background(), displayName, "sequential")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(name).To(Equal("some-display-name-3"))
+				Expect(logger.WarnCall.Receives.Message).To(Equal("The display name some-display-name is taken by application with id 1234, using some-display-name-3."))
+			})
+		})
+
+		Context("when a random suffix is requested", func() {
+			It("appends a short random suffix", func() {
+				name, err := azure.AvailableDisplayName(context.Background(), displayName, "random")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(name).To(MatchRegexp(`^some-display-name-[0-9a-f]{6}$`))
+			})
+		})
+
+		Context("when collisions should fail", func() {
+			It("returns a helpful error", func() {
+				_, err := azure.AvailableDisplayName(context.Background(), displayName, "fail")
+				Expect(err).To(MatchError("The --display-name some-display-name is taken by application with id 1234."))
+			})
+		})
+	})
+
 	Describe("CreateApplication", func() {
 		var clientSecret string
 		BeforeEach(func() {
@@ -193,7 +353,7 @@ var _ = Describe("Az", func() {
 		})
 
 		It("returns the client id and client secret", func() {
-			clientId, err := azure.CreateApplication(clientSecret, displayName, identifierUri)
+			clientId, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Time{})
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "create",
@@ -203,7 +363,42 @@ var _ = Describe("Az", func() {
 				"--password", "the-client-secret",
 			}))
 			Expect(clientId).To(Equal("the-client-id"))
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Created application."))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Created application."))
+		})
+
+		Context("when an end date is provided", func() {
+			It("sets the expiry of the password", func() {
+				_, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(ContainElement("--end-date"))
+				Expect(cli.ExecuteCall.Receives.Args).To(ContainElement("2019-01-02T03:04:05Z"))
+			})
+		})
+
+		Context("when no identifier uri is provided", func() {
+			It("creates the application without one", func() {
+				_, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, "", time.Time{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "create",
+					"--display-name", "some-display-name",
+					"--password", "the-client-secret",
+				}))
+			})
+		})
+
+		Context("when no client secret is provided", func() {
+			It("creates the application without a password", func() {
+				_, _, err := azure.CreateApplication(context.Background(), "", displayName, identifierUri, time.Time{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "create",
+					"--display-name", "some-display-name",
+					"--homepage", "http://some-identifier-uri",
+					"--identifier-uris", "http://some-identifier-uri",
+				}))
+			})
 		})
 
 		Context("when the cli returns an error", func() {
@@ -212,31 +407,283 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpful error", func() {
-				_, err := azure.CreateApplication(clientSecret, displayName, identifierUri)
+				_, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Time{})
 				Expect(err).To(MatchError(ContainSubstring("Running [ad app create --display-name some-display-name")))
 				Expect(err).NotTo(MatchError(ContainSubstring("--password the-client-secret")))
 			})
 		})
 
+		Context("when the azure-cli speaks Microsoft Graph", func() {
+			BeforeEach(func() {
+				azure = azure.WithDialect(az.MicrosoftGraph)
+				cli.ExecuteCall.Stub = func(args []string) (string, error) {
+					if args[2] == "credential" {
+						return `{"appId": "the-client-id", "password": "the-generated-secret", "tenant": "some-tenant-id"}`, nil
+					}
+					return `{"appId": "the-client-id", "id": "the-object-id"}`, nil
+				}
+			})
+
+			It("creates the application and then generates its client secret", func() {
+				clientId, secret, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.AllArgs).To(Equal([][]string{
+					{"ad", "app", "create",
+						"--display-name", "some-display-name",
+						"--web-home-page-url", "http://some-identifier-uri",
+						"--identifier-uris", "http://some-identifier-uri"},
+					{"ad", "app", "credential", "reset",
+						"--id", "the-client-id",
+						"--end-date", "2019-01-02T03:04:05Z"},
+				}))
+				Expect(clientId).To(Equal("the-client-id"))
+				Expect(secret).To(Equal("the-generated-secret"))
+			})
+
+			Context("when no client secret is wanted", func() {
+				It("only creates the application", func() {
+					_, secret, err := azure.CreateApplication(context.Background(), "", displayName, identifierUri, time.Time{})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(cli.ExecuteCall.CallCount).To(Equal(1))
+					Expect(secret).To(BeEmpty())
+				})
+			})
+
+			Context("when the client secret cannot be generated", func() {
+				It("returns the client id with the error", func() {
+					cli.ExecuteCall.Stub = func(args []string) (string, error) {
+						if args[2] == "credential" {
+							return "some-error", errors.New("exit status 1")
+						}
+						return `{"appId": "the-client-id"}`, nil
+					}
+
+					clientId, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Time{})
+					Expect(err).To(MatchError(ContainSubstring("Running [ad app credential reset --id the-client-id]: some-error")))
+					Expect(clientId).To(Equal("the-client-id"))
+				})
+			})
+		})
+
 		Context("when the application json is invalid", func() {
 			BeforeEach(func() {
 				cli.ExecuteCall.Returns.Output = `{$$$}`
 			})
 
 			It("returns a helpful error", func() {
-				_, err := azure.CreateApplication(clientSecret, displayName, identifierUri)
+				_, _, err := azure.CreateApplication(context.Background(), clientSecret, displayName, identifierUri, time.Time{})
 				Expect(err).To(MatchError(ContainSubstring("Unmarshalling application json: ")))
 			})
 		})
 	})
 
+	Describe("ShowApplication", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `{
+				"appId": "the-client-id",
+				"objectId": "the-object-id",
+				"displayName": "some-display-name",
+				"passwordCredentials": [{"keyId": "the-key-id", "endDate": "2020-01-02T03:04:05Z"}]
+			}`
+		})
+
+		It("returns the application", func() {
+			application, err := azure.ShowApplication(context.Background(), "the-client-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "show", "--id", "the-client-id"}))
+			Expect(application.Id).To(Equal("the-object-id"))
+			Expect(application.DisplayName).To(Equal("some-display-name"))
+			Expect(application.PasswordCredentials).To(Equal([]az.PasswordCredential{{KeyId: "the-key-id", EndDate: "2020-01-02T03:04:05Z"}}))
+		})
+
+		Context("when the azure-cli speaks Microsoft Graph", func() {
+			It("reads the ids and expiries of its json", func() {
+				cli.ExecuteCall.Returns.Output = `{
+					"appId": "the-client-id",
+					"id": "the-object-id",
+					"passwordCredentials": [{"keyId": "the-key-id", "endDateTime": "2020-01-02T03:04:05Z"}]
+				}`
+
+				application, err := azure.ShowApplication(context.Background(), "the-client-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(application.Id).To(Equal("the-object-id"))
+				Expect(application.PasswordCredentials[0].EndDate).To(Equal("2020-01-02T03:04:05Z"))
+			})
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error", func() {
+				_, err := azure.ShowApplication(context.Background(), "the-client-id")
+				Expect(err).To(MatchError(ContainSubstring("Running [ad app show --id the-client-id]: ")))
+			})
+		})
+	})
+
+	Describe("ShowServicePrincipal", func() {
+		It("returns the service principal", func() {
+			cli.ExecuteCall.Returns.Output = `{"appId": "the-client-id", "id": "the-object-id"}`
+
+			servicePrincipal, err := azure.ShowServicePrincipal(context.Background(), "the-client-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "sp", "show", "--id", "the-client-id"}))
+			Expect(servicePrincipal.Id).To(Equal("the-object-id"))
+		})
+	})
+
+	Describe("ListRoleAssignments", func() {
+		It("returns the role assignments of the service principal", func() {
+			cli.ExecuteCall.Returns.Output = `[{"id": "the-assignment-id", "roleDefinitionName": "Reader", "scope": "/subscriptions/1234"}]`
+
+			assignments, err := azure.ListRoleAssignments(context.Background(), "the-client-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "list", "--assignee", "the-client-id", "--all"}))
+			Expect(assignments).To(Equal([]az.RoleAssignment{{Id: "the-assignment-id", RoleDefinitionName: "Reader", Scope: "/subscriptions/1234"}}))
+		})
+
+		Context("with a subscription", func() {
+			It("lists them in the subscription", func() {
+				cli.ExecuteCall.Returns.Output = `[]`
+
+				_, err := azure.WithSubscription("some-id").ListRoleAssignments(context.Background(), "the-client-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "list", "--assignee", "the-client-id", "--all", "--subscription", "some-id"}))
+			})
+		})
+	})
+
+	Describe("DeleteRoleAssignment", func() {
+		It("deletes the role assignment", func() {
+			err := azure.DeleteRoleAssignment(context.Background(), "the-assignment-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "delete", "--ids", "the-assignment-id"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Deleted role assignment the-assignment-id."))
+		})
+	})
+
+	Describe("ResetPassword", func() {
+		It("replaces the client secrets of the application", func() {
+			_, err := azure.ResetPassword(context.Background(), "the-client-id", "the-password", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "credential", "reset",
+				"--id", "the-client-id",
+				"--password", "the-password",
+				"--end-date", "2020-01-02T03:04:05Z"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Reset client secret of application."))
+		})
+
+		Context("when the azure-cli speaks Microsoft Graph", func() {
+			It("returns the secret it generated", func() {
+				cli.ExecuteCall.Returns.Output = `{"appId": "the-client-id", "password": "the-generated-secret"}`
+
+				secret, err := azure.WithDialect(az.MicrosoftGraph).ResetPassword(context.Background(), "the-client-id", "the-password", time.Time{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "credential", "reset", "--id", "the-client-id"}))
+				Expect(secret).To(Equal("the-generated-secret"))
+			})
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error without the password", func() {
+				_, err := azure.ResetPassword(context.Background(), "the-client-id", "the-password", time.Time{})
+				Expect(err).To(MatchError(ContainSubstring("Running [ad app credential reset --id the-client-id]: ")))
+				Expect(err.Error()).NotTo(ContainSubstring("the-password"))
+			})
+		})
+	})
+
+	Describe("AppendPassword", func() {
+		It("adds a client secret to the application", func() {
+			_, err := azure.AppendPassword(context.Background(), "the-client-id", "the-password", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "credential", "reset",
+				"--id", "the-client-id",
+				"--append",
+				"--password", "the-password",
+				"--end-date", "2020-01-02T03:04:05Z"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Added client secret to application."))
+		})
+	})
+
+	Describe("DeletePassword", func() {
+		It("deletes the client secret with the key id", func() {
+			err := azure.DeletePassword(context.Background(), "the-client-id", "the-key-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "credential", "delete", "--id", "the-client-id", "--key-id", "the-key-id"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Deleted client secret the-key-id."))
+		})
+	})
+
+	Describe("DeleteApplication", func() {
+		It("deletes the application", func() {
+			err := azure.DeleteApplication(context.Background(), "the-client-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "delete", "--id", "the-client-id"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Deleted application the-client-id."))
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error", func() {
+				err := azure.DeleteApplication(context.Background(), "the-client-id")
+				Expect(err).To(MatchError(ContainSubstring("Running [ad app delete --id the-client-id]: ")))
+			})
+		})
+	})
+
 	Describe("CreateServicePrincipal", func() {
-		It("creates the service principal", func() {
-			err := azure.CreateServicePrincipal("the-client-id")
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `{"appId": "the-client-id", "id": "the-object-id"}`
+		})
+
+		It("creates the service principal and returns its object id", func() {
+			objectId, err := azure.CreateServicePrincipal(context.Background(), "the-client-id")
 			Expect(err).NotTo(HaveOccurred())
 
+			Expect(objectId).To(Equal("the-object-id"))
 			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "sp", "create", "--id", "the-client-id"}))
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Created service principal."))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Created service principal."))
+			Expect(logger.InfoCall.Receives.Fields).To(Equal([]az.Field{
+				az.F("step", "create-service-principal"),
+				az.F("app_id", "the-client-id"),
+				az.F("object_id", "the-object-id"),
+			}))
+		})
+
+		Context("when the azure-cli returns the object id as objectId", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `{"appId": "the-client-id", "objectId": "the-object-id"}`
+			})
+
+			It("returns it", func() {
+				objectId, err := azure.CreateServicePrincipal(context.Background(), "the-client-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(objectId).To(Equal("the-object-id"))
+			})
 		})
 
 		Context("when the cli returns an error", func() {
@@ -245,21 +692,59 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpeful error", func() {
-				err := azure.CreateServicePrincipal("the-client-id")
+				_, err := azure.CreateServicePrincipal(context.Background(), "the-client-id")
 				Expect(err).To(MatchError(ContainSubstring("Running [ad sp create --id the-client-id]: ")))
 			})
 		})
 	})
 
+	Describe("CreateFederatedCredential", func() {
+		var credential az.FederatedCredential
+		BeforeEach(func() {
+			credential = az.FederatedCredential{
+				Name:      "some-name",
+				Issuer:    "https://some-issuer",
+				Subject:   "some-subject",
+				Audiences: []string{"some-audience"},
+			}
+		})
+
+		It("creates the federated credential on the application", func() {
+			err := azure.CreateFederatedCredential(context.Background(), "the-client-id", credential)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "federated-credential", "create",
+				"--id", "the-client-id",
+				"--parameters", `{"name":"some-name","issuer":"https://some-issuer","subject":"some-subject","audiences":["some-audience"]}`,
+			}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Created federated credential for subject some-subject."))
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error", func() {
+				err := azure.CreateFederatedCredential(context.Background(), "the-client-id", credential)
+				Expect(err).To(MatchError(ContainSubstring("Running [ad app federated-credential create --id the-client-id")))
+			})
+		})
+	})
+
 	Describe("AssignContributorRole", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `{"id": "the-role-assignment-id"}`
+		})
+
 		It("assigns the contributor role to the service principal", func() {
-			err := azure.AssignContributorRole("the-client-id")
+			err := azure.AssignContributorRole(context.Background(), "the-client-id")
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "create",
 				"--role", "Contributor",
 				"--assignee", "the-client-id"}))
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Assigned contributor role to service principal."))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Assigned contributor role to service principal."))
 		})
 
 		Context("when the cli returns an error", func() {
@@ -268,30 +753,39 @@ var _ = Describe("Az", func() {
 			})
 
 			It("returns a helpeful error", func() {
-				err := azure.AssignContributorRole("the-client-id")
+				err := azure.AssignContributorRole(context.Background(), "the-client-id")
 				Expect(err).To(MatchError(ContainSubstring("Running [role assignment create --role Contributor --assignee the-client-id]: ")))
 			})
 		})
 	})
 
-	Describe("WriteCredentials", func() {
-		AfterEach(func() {
-			err := os.Remove("some-credential-file")
-			Expect(err).NotTo(HaveOccurred())
+	Describe("AssignRole", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `{"id": "the-role-assignment-id"}`
 		})
 
-		It("writes the credentials to the specified output file", func() {
-			err := azure.WriteCredentials("subscription-id", "tenant-id", "client-id", "client-secret", credentialOutputFile)
+		It("assigns the role at the scope and returns the id of the assignment", func() {
+			id, err := azure.AssignRole(context.Background(), "the-client-id", "Reader", "/subscriptions/some-id/resourceGroups/some-group")
 			Expect(err).NotTo(HaveOccurred())
 
-			bytes, err := ioutil.ReadFile(credentialOutputFile)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(string(bytes)).To(ContainSubstring("subscription_id = \"subscription-id\""))
-			Expect(string(bytes)).To(ContainSubstring("tenant_id = \"tenant-id\""))
-			Expect(string(bytes)).To(ContainSubstring("client_id = \"client-id\""))
-			Expect(string(bytes)).To(ContainSubstring("client_secret = \"client-secret\""))
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "create",
+				"--role", "Reader",
+				"--assignee", "the-client-id",
+				"--scope", "/subscriptions/some-id/resourceGroups/some-group"}))
+			Expect(id).To(Equal("the-role-assignment-id"))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Assigned reader role to service principal at /subscriptions/some-id/resourceGroups/some-group."))
+		})
 
-			Expect(logger.PrintlnCall.Receives.Message).To(Equal("Wrote credentials to some-credential-file."))
+		Context("with a subscription", func() {
+			It("assigns the role in the subscription", func() {
+				_, err := azure.WithSubscription("some-id").AssignRole(context.Background(), "the-client-id", "Reader", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"role", "assignment", "create",
+					"--role", "Reader",
+					"--assignee", "the-client-id",
+					"--subscription", "some-id"}))
+			})
 		})
 	})
 })
@@ -0,0 +1,218 @@
+package az
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Interaction is one azure-cli command in a cassette, with the values of
+// secret flags redacted from its arguments and output, along with the secrets
+// the azure-cli generates.
+type Interaction struct {
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exit_code"`
+}
+
+type RecordingCLI struct {
+	cli   cli
+	file  *os.File
+	mutex *sync.Mutex
+}
+
+// runner is a cli that also returns both streams and the exit code of a
+// command, like CLI.
+type runner interface {
+	Run(ctx context.Context, args []string) (Result, error)
+	output(args []string, result Result, err error) (string, error)
+}
+
+// NewRecordingCLI executes commands with cli and appends each of them to the
+// cassette at path, one json interaction per line, for a ReplayCLI to serve
+// later. The stdout, stderr and exit code of the azure-cli are recorded as
+// they are; other backends only return the output, which is recorded as
+// stderr when the command failed.
+func NewRecordingCLI(cli cli, path string) (*RecordingCLI, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Opening cassette: %s", err))
+	}
+
+	return &RecordingCLI{
+		cli:   cli,
+		file:  file,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+func (r *RecordingCLI) Execute(ctx context.Context, args []string) (string, error) {
+	var (
+		result Result
+		output string
+		err    error
+	)
+	if runner, ok := r.cli.(runner); ok {
+		result, err = runner.Run(ctx, args)
+		output, err = runner.output(args, result, err)
+	} else {
+		output, err = r.cli.Execute(ctx, args)
+		result = Result{ExitCode: exitCode(err)}
+		if err != nil {
+			result.Stderr = output
+		} else {
+			result.Stdout = output
+		}
+	}
+
+	redactedArgs, secrets := redact(args)
+
+	interaction := Interaction{
+		Args:     redactedArgs,
+		Stdout:   redactOutput(result.Stdout, secrets),
+		Stderr:   redactOutput(result.Stderr, secrets),
+		ExitCode: result.ExitCode,
+	}
+
+	line, marshalErr := json.Marshal(interaction)
+	if marshalErr != nil {
+		return output, errors.New(fmt.Sprintf("Marshalling cassette json: %s", marshalErr))
+	}
+
+	r.mutex.Lock()
+	_, writeErr := r.file.Write(append(line, '\n'))
+	r.mutex.Unlock()
+	if writeErr != nil {
+		return output, errors.New(fmt.Sprintf("Writing cassette: %s", writeErr))
+	}
+
+	return output, err
+}
+
+func (r *RecordingCLI) Close() error {
+	return r.file.Close()
+}
+
+// ExitError is the error of a replayed command that failed, with the exit
+// code it was recorded with.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e ExitError) ExitCode() int {
+	return e.Code
+}
+
+type ReplayCLI struct {
+	interactions []Interaction
+	used         []bool
+	mutex        *sync.Mutex
+}
+
+// NewReplayCLI serves the interactions of the cassette at path instead of
+// running the azure-cli.
+func NewReplayCLI(path string) (*ReplayCLI, error) {
+	interactions, err := ReadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayCLI{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+		mutex:        &sync.Mutex{},
+	}, nil
+}
+
+// Execute returns the first interaction not yet served whose arguments match
+// args once their secrets are redacted. Dates, such as the end date of a
+// secret or the expiry of a key vault secret, are not compared. A recorded failure is returned as an ExitError,
+// with stderr followed by stdout like CLI.
+func (r *ReplayCLI) Execute(ctx context.Context, args []string) (string, error) {
+	if ctx.Err() != nil {
+		return "The azure-cli was interrupted.", ctx.Err()
+	}
+
+	redactedArgs, _ := redact(args)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || !sameArgs(interaction.Args, redactedArgs) {
+			continue
+		}
+		r.used[i] = true
+
+		if interaction.ExitCode != 0 {
+			return join(interaction.Stderr, interaction.Stdout), ExitError{Code: interaction.ExitCode}
+		}
+		return interaction.Stdout, nil
+	}
+
+	return "", errors.New(fmt.Sprintf("No recorded azure-cli command matches %s.", strings.Join(redactedArgs, " ")))
+}
+
+// ReadCassette reads the interactions recorded by a RecordingCLI.
+func ReadCassette(path string) ([]Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Opening cassette: %s", err))
+	}
+	defer file.Close()
+
+	var interactions []Interaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var interaction Interaction
+		err = json.Unmarshal(scanner.Bytes(), &interaction)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Unmarshalling line %d of cassette: %s", line, err))
+		}
+		interactions = append(interactions, interaction)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Reading cassette: %s", err))
+	}
+
+	return interactions, nil
+}
+
+// volatileFlags change from one run to the next, so any recorded value of
+// theirs matches.
+var volatileFlags = map[string]bool{
+	"--end-date": true,
+	"--expires":  true,
+}
+
+func sameArgs(recorded, args []string) bool {
+	if len(recorded) != len(args) {
+		return false
+	}
+	for i := range recorded {
+		if i > 0 && volatileFlags[recorded[i-1]] {
+			continue
+		}
+		if recorded[i] != args[i] {
+			return false
+		}
+	}
+	return true
+}
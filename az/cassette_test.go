@@ -0,0 +1,187 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cassette", func() {
+	var (
+		dir  string
+		path string
+		cli  *fakes.CLI
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cassette")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "az.cassette")
+		cli = &fakes.CLI{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("RecordingCLI", func() {
+		It("records each command with its secrets scrubbed", func() {
+			recording, err := az.NewRecordingCLI(cli, path)
+			Expect(err).NotTo(HaveOccurred())
+
+			cli.ExecuteCall.Returns.Output = `{"password": "some-password"}`
+			output, err := recording.Execute(context.Background(), []string{"ad", "app", "credential", "reset", "--password", "some-password"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`{"password": "some-password"}`))
+
+			cli.ExecuteCall.Returns.Output = `{"appId": "some-app-id", "password": "generated-password"}`
+			output, err = recording.Execute(context.Background(), []string{"ad", "app", "credential", "reset", "--id", "some-app-id"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring("generated-password"))
+
+			cli.ExecuteCall.Returns.Output = "some-error"
+			cli.ExecuteCall.Returns.Error = errors.New("some error")
+			_, err = recording.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).To(MatchError("some error"))
+
+			Expect(recording.Close()).To(Succeed())
+
+			interactions, err := az.ReadCassette(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interactions).To(Equal([]az.Interaction{
+				{
+					Args:   []string{"ad", "app", "credential", "reset", "--password", "REDACTED"},
+					Stdout: `{"password": "REDACTED"}`,
+				},
+				{
+					Args:   []string{"ad", "app", "credential", "reset", "--id", "some-app-id"},
+					Stdout: `{"appId": "some-app-id", "password": "REDACTED"}`,
+				},
+				{
+					Args:     []string{"account", "list"},
+					Stderr:   "some-error",
+					ExitCode: -1,
+				},
+			}))
+		})
+
+		Context("when it records the azure-cli", func() {
+			It("keeps both streams and the exit code", func() {
+				sh, err := exec.LookPath("sh")
+				if err != nil {
+					Skip("Failed to locate sh.")
+				}
+
+				recording, err := az.NewRecordingCLI(az.NewCLI(sh, time.Minute, nil, &fakes.Logger{}), path)
+				Expect(err).NotTo(HaveOccurred())
+
+				output, err := recording.Execute(context.Background(), []string{"-c", "echo out; echo err >&2; exit 3"})
+				Expect(err).To(HaveOccurred())
+				Expect(output).To(Equal("err\nout"))
+				Expect(recording.Close()).To(Succeed())
+
+				interactions, err := az.ReadCassette(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(interactions).To(Equal([]az.Interaction{{
+					Args:     []string{"-c", "echo out; echo err >&2; exit 3"},
+					Stdout:   "out\n",
+					Stderr:   "err\n",
+					ExitCode: 3,
+				}}))
+
+				replay, err := az.NewReplayCLI(path)
+				Expect(err).NotTo(HaveOccurred())
+
+				output, err = replay.Execute(context.Background(), []string{"-c", "echo out; echo err >&2; exit 3"})
+				Expect(err).To(Equal(az.ExitError{Code: 3}))
+				Expect(output).To(Equal("err\nout"))
+			})
+		})
+	})
+
+	Describe("ReplayCLI", func() {
+		It("serves the recorded commands in order", func() {
+			recording, err := az.NewRecordingCLI(cli, path)
+			Expect(err).NotTo(HaveOccurred())
+
+			cli.ExecuteCall.Returns.Output = "first"
+			_, err = recording.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			cli.ExecuteCall.Returns.Output = "second"
+			_, err = recording.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recording.Close()).To(Succeed())
+
+			replay, err := az.NewReplayCLI(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := replay.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("first"))
+
+			output, err = replay.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("second"))
+
+			_, err = replay.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).To(MatchError("No recorded azure-cli command matches account list."))
+		})
+
+		It("replays real azure-cli output to Az", func() {
+			replay, err := az.NewReplayCLI("testdata/create-application.cassette")
+			Expect(err).NotTo(HaveOccurred())
+
+			azure := az.NewAz(replay, &fakes.Logger{})
+
+			Expect(azure.AppExists(context.Background(), "some-app")).To(Succeed())
+
+			clientId, _, err := azure.CreateApplication(context.Background(), "a-new-password", "some-app", "", time.Now().AddDate(1, 0, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientId).To(Equal("2b4e1a6c-7a3d-4f5e-9c1b-0d2e3f4a5b6c"))
+
+			_, err = azure.CreateServicePrincipal(context.Background(), clientId)
+			Expect(err).To(MatchError(ContainSubstring("Another object with the same value for property servicePrincipalNames already exists.")))
+		})
+
+		It("replays a key vault write recorded with another expiry", func() {
+			recording, err := az.NewRecordingCLI(cli, path)
+			Expect(err).NotTo(HaveOccurred())
+
+			config := az.KeyVaultConfig{Name: "some-vault"}
+			credentials := az.Credentials{
+				SubscriptionId: "subscription-id",
+				ClientId:       "client-id",
+				ClientSecret:   "recorded-secret",
+				ExpiresOn:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+			Expect(az.NewKeyVault(recording, &fakes.Logger{}, config).Write(context.Background(), credentials)).To(Succeed())
+			Expect(recording.Close()).To(Succeed())
+
+			replay, err := az.NewReplayCLI(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials.ClientSecret = "replayed-secret"
+			credentials.ExpiresOn = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+			Expect(az.NewKeyVault(replay, &fakes.Logger{}, config).Write(context.Background(), credentials)).To(Succeed())
+		})
+
+		Context("when the cassette does not exist", func() {
+			It("returns an error", func() {
+				_, err := az.NewReplayCLI(filepath.Join(dir, "missing.cassette"))
+				Expect(err).To(MatchError(ContainSubstring("Opening cassette:")))
+			})
+		})
+	})
+})
@@ -2,31 +2,165 @@ package az
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
+	"strings"
+	"time"
 )
 
+// waitDelay bounds how long Execute waits for the output of a command that
+// was killed, in case a child of the azure-cli still holds it open.
+const waitDelay = 5 * time.Second
+
+// settings override the configuration of the azure-cli, so that whatever the
+// user has set with `az configure` its output is json without colour or
+// telemetry, and it never prompts or installs extensions. Versions that do
+// not know a setting ignore it. Warnings are left on, as Execute logs them;
+// they go to stderr, so the json on stdout is parsed without them.
+var settings = []string{
+	"AZURE_CORE_OUTPUT=json",
+	"AZURE_CORE_NO_COLOR=true",
+	"AZURE_CORE_COLLECT_TELEMETRY=false",
+	"AZURE_CORE_DISABLE_CONFIRM_PROMPT=true",
+	"AZURE_EXTENSION_USE_DYNAMIC_INSTALL=no",
+}
+
 type CLI struct {
-	path string
+	path    string
+	timeout time.Duration
+	env     []string
+	logger  logger
+}
+
+// Result is what a command printed and how it exited.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
 }
 
-func NewCLI(path string) CLI {
+// NewCLI runs the azure-cli at path in the environment env, a list of
+// key=value pairs like os.Environ, with the settings added. Each command is
+// killed along with its children once the timeout has passed, or right away
+// when its context is cancelled. A timeout of zero leaves the commands to the
+// context. The warnings of commands that succeed are logged to logger.
+func NewCLI(path string, timeout time.Duration, env []string, logger logger) CLI {
 	return CLI{
-		path: path,
+		path:    path,
+		timeout: timeout,
+		env:     append(append([]string{}, env...), settings...),
+		logger:  logger,
+	}
+}
+
+// Execute returns the stdout of the command once it succeeds, after logging
+// what it printed to stderr as warnings. When it fails the output is stderr
+// followed by stdout.
+func (c CLI) Execute(ctx context.Context, args []string) (string, error) {
+	result, err := c.Run(ctx, args)
+	return c.output(args, result, err)
+}
+
+// output is what Execute returns for the result of a command run with args.
+func (c CLI) output(args []string, result Result, err error) (string, error) {
+	if err != nil {
+		return join(result.Stderr, result.Stdout), err
+	}
+
+	for _, warning := range warnings(result.Stderr) {
+		c.logger.Warn(warning, F("step", "az"), F("command", command(args)))
 	}
+
+	return result.Stdout, nil
 }
 
-func (c CLI) Execute(args []string) (string, error) {
+// Run runs the command and returns both its streams and its exit code, which
+// is -1 when it did not exit by itself. When the command did not finish in
+// time or was interrupted, stderr starts by saying so.
+func (c CLI) Run(ctx context.Context, args []string) (Result, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
 	outBuffer := bytes.NewBuffer([]byte{})
 	errBuffer := bytes.NewBuffer([]byte{})
 
-	cmd := exec.Command(c.path, args...)
+	cmd := exec.CommandContext(ctx, c.path, jsonOutput(args)...)
+	cmd.Env = c.env
 	cmd.Stdout = outBuffer
 	cmd.Stderr = errBuffer
+	cmd.WaitDelay = waitDelay
+	killProcessGroup(cmd)
 
 	err := cmd.Run()
-	if err != nil {
-		return errBuffer.String(), err
+	result := Result{
+		Stdout:   outBuffer.String(),
+		Stderr:   errBuffer.String(),
+		ExitCode: exitCode(err),
+	}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		result.Stderr = join("The azure-cli did not finish in time.", result.Stderr)
+		return result, ctx.Err()
+	case context.Canceled:
+		result.Stderr = join("The azure-cli was interrupted.", result.Stderr)
+		return result, ctx.Err()
+	}
+
+	return result, err
+}
+
+// warnings are the lines of stderr, without the WARNING: prefix the
+// azure-cli gives most of them.
+func warnings(stderr string) []string {
+	var lines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "WARNING:"))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// command is the azure-cli command of args without its flags, such as
+// "ad app create".
+func command(args []string) string {
+	var words []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// join joins the streams of a command that are not empty.
+func join(streams ...string) string {
+	var parts []string
+	for _, stream := range streams {
+		if stream = strings.TrimSpace(stream); stream != "" {
+			parts = append(parts, stream)
+		}
 	}
+	return strings.Join(parts, "\n")
+}
 
-	return outBuffer.String(), nil
+// jsonOutput asks for json output on the command line too, where it also
+// beats an --output in the defaults of the azure-cli. Global flags like -v
+// take no --output.
+func jsonOutput(args []string) []string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args
+	}
+	for _, arg := range args {
+		if arg == "--output" || arg == "-o" || strings.HasPrefix(arg, "--output=") {
+			return args
+		}
+	}
+	return append(append([]string{}, args...), "--output", "json")
 }
@@ -1,31 +1,142 @@
 package az_test
 
 import (
+	"context"
 	"os/exec"
+	"time"
 
 	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("CLI", func() {
-	var cli az.CLI
+	var (
+		cli    az.CLI
+		logger *fakes.Logger
+	)
 
 	BeforeEach(func() {
+		logger = &fakes.Logger{}
+
 		path, err := exec.LookPath("echo")
 		if err != nil {
 			Skip("Failed to locate echo.")
 		}
 
-		cli = az.NewCLI(path)
+		cli = az.NewCLI(path, time.Minute, nil, logger)
 	})
 
 	Describe("Execute", func() {
 		It("returns the output of the command it executed", func() {
-			output, err := cli.Execute([]string{"fake", "arg"})
+			output, err := cli.Execute(context.Background(), []string{"fake", "arg"})
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(output).To(ContainSubstring("fake arg"))
 		})
+
+		It("asks for json output unless the command already does", func() {
+			output, err := cli.Execute(context.Background(), []string{"fake", "arg"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("fake arg --output json\n"))
+
+			output, err = cli.Execute(context.Background(), []string{"version", "--output", "json"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("version --output json\n"))
+
+			output, err = cli.Execute(context.Background(), []string{"-v"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("-v\n"))
+		})
+
+		Context("when the user has configured the azure-cli", func() {
+			BeforeEach(func() {
+				path, err := exec.LookPath("sh")
+				if err != nil {
+					Skip("Failed to locate sh.")
+				}
+
+				cli = az.NewCLI(path, time.Minute, []string{"AZURE_CORE_OUTPUT=table", "AZURE_CONFIG_DIR=/some/dir"}, logger)
+			})
+
+			It("overrides the settings that change its output or make it interactive", func() {
+				output, err := cli.Execute(context.Background(), []string{"-c", "echo $AZURE_CORE_OUTPUT $AZURE_CORE_NO_COLOR $AZURE_CORE_COLLECT_TELEMETRY $AZURE_CORE_DISABLE_CONFIRM_PROMPT $AZURE_CONFIG_DIR ${AZURE_CORE_ONLY_SHOW_ERRORS-warnings}"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(output).To(Equal("json true false true /some/dir warnings\n"))
+			})
+		})
+
+		Context("when the command prints warnings", func() {
+			BeforeEach(func() {
+				path, err := exec.LookPath("sh")
+				if err != nil {
+					Skip("Failed to locate sh.")
+				}
+
+				cli = az.NewCLI(path, time.Minute, nil, logger)
+			})
+
+			It("logs them and returns stdout", func() {
+				output, err := cli.Execute(context.Background(), []string{"-c", "echo '{}'; echo 'WARNING: The password will expire.' >&2"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(output).To(Equal("{}\n"))
+				Expect(logger.WarnCall.CallCount).To(Equal(1))
+				Expect(logger.WarnCall.Receives.Message).To(Equal("The password will expire."))
+			})
+
+			Context("when the command fails", func() {
+				It("returns both streams", func() {
+					output, err := cli.Execute(context.Background(), []string{"-c", "echo '{}'; echo 'ERROR: Insufficient privileges.' >&2; exit 3"})
+					Expect(err).To(HaveOccurred())
+
+					Expect(output).To(Equal("ERROR: Insufficient privileges.\n{}"))
+					Expect(logger.WarnCall.CallCount).To(Equal(0))
+				})
+			})
+
+			Describe("Run", func() {
+				It("returns the streams and the exit code", func() {
+					result, err := cli.Run(context.Background(), []string{"-c", "echo out; echo err >&2; exit 3"})
+					Expect(err).To(HaveOccurred())
+
+					Expect(result).To(Equal(az.Result{Stdout: "out\n", Stderr: "err\n", ExitCode: 3}))
+				})
+			})
+		})
+
+		Context("when the command does not finish in time", func() {
+			BeforeEach(func() {
+				path, err := exec.LookPath("sh")
+				if err != nil {
+					Skip("Failed to locate sh.")
+				}
+
+				cli = az.NewCLI(path, 100*time.Millisecond, nil, logger)
+			})
+
+			It("kills the command and its children", func() {
+				start := time.Now()
+				output, err := cli.Execute(context.Background(), []string{"-c", "sleep 10; echo done"})
+				Expect(err).To(Equal(context.DeadlineExceeded))
+
+				Expect(output).To(Equal("The azure-cli did not finish in time."))
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			It("returns without running the command", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				output, err := cli.Execute(ctx, []string{"fake", "arg"})
+				Expect(err).To(Equal(context.Canceled))
+
+				Expect(output).To(Equal("The azure-cli was interrupted."))
+			})
+		})
 	})
 })
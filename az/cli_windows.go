@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package az
+
+import "os/exec"
+
+// killProcessGroup leaves the default of killing the command itself on
+// cancellation, as there are no process groups to signal on windows.
+func killProcessGroup(cmd *exec.Cmd) {}
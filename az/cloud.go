@@ -0,0 +1,154 @@
+package az
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Cloud struct {
+	Name      string         `json:"name"`
+	IsActive  bool           `json:"isActive"`
+	Endpoints CloudEndpoints `json:"endpoints"`
+}
+
+type CloudEndpoints struct {
+	ActiveDirectory                string `json:"activeDirectory"`
+	ActiveDirectoryGraphResourceId string `json:"activeDirectoryGraphResourceId"`
+	MicrosoftGraphResourceId       string `json:"microsoftGraphResourceId"`
+	ResourceManager                string `json:"resourceManager"`
+	Management                     string `json:"management"`
+	SQLManagement                  string `json:"sqlManagement"`
+	Gallery                        string `json:"gallery"`
+}
+
+var knownClouds = map[string]struct {
+	terraform string
+	sdk       string
+}{
+	"AzureCloud":        {"public", "AzurePublicCloud"},
+	"AzureUSGovernment": {"usgovernment", "AzureUSGovernmentCloud"},
+	"AzureChinaCloud":   {"china", "AzureChinaCloud"},
+	"AzureGermanCloud":  {"german", "AzureGermanCloud"},
+}
+
+// Custom reports whether the cloud is a registered custom or Azure Stack
+// cloud rather than one of the clouds built in to the azure-cli.
+func (c Cloud) Custom() bool {
+	_, ok := knownClouds[c.Name]
+	return c.Name != "" && !ok
+}
+
+// TerraformEnvironment is the environment argument of the azurerm provider.
+// Custom clouds have no environment name and are configured through the
+// metadata host instead.
+func (c Cloud) TerraformEnvironment() string {
+	return knownClouds[c.Name].terraform
+}
+
+// SDKEnvironment is the environment name used by the Azure SDKs and the
+// kubernetes cloud provider.
+func (c Cloud) SDKEnvironment() string {
+	if c.Custom() {
+		return "AzureStackCloud"
+	}
+	return knownClouds[c.Name].sdk
+}
+
+// MetadataHost is the host of the resource manager endpoint, which serves the
+// metadata describing the other endpoints of the cloud.
+func (c Cloud) MetadataHost() string {
+	host := strings.TrimPrefix(c.Endpoints.ResourceManager, "https://")
+	return strings.TrimSuffix(host, "/")
+}
+
+func (c Cloud) GraphEndpoint() string {
+	if c.Endpoints.MicrosoftGraphResourceId != "" {
+		return c.Endpoints.MicrosoftGraphResourceId
+	}
+	return c.Endpoints.ActiveDirectoryGraphResourceId
+}
+
+// restoreTimeout bounds how long making the previously active cloud active
+// again may take, once the command is done.
+const restoreTimeout = time.Minute
+
+// ShowCloud returns the cloud of the azure-cli with the name, or the active
+// cloud when the name is empty, without changing which cloud is active.
+func (a Az) ShowCloud(ctx context.Context, name string) (Cloud, error) {
+	args := []string{"cloud", "show"}
+	if name != "" {
+		args = append(args, "--name", name)
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		if name != "" && strings.Contains(strings.ToLower(output), "is not registered") {
+			return Cloud{}, errors.New(fmt.Sprintf("The --cloud %s is not registered with the azure-cli. Use 'az cloud list' to see your clouds.", name))
+		}
+		return Cloud{}, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	cloud := Cloud{}
+	err = json.Unmarshal([]byte(output), &cloud)
+	if err != nil {
+		return Cloud{}, errors.New(fmt.Sprintf("Unmarshalling cloud json: %s", err))
+	}
+
+	return cloud, nil
+}
+
+// SelectCloud returns the active cloud of the azure-cli. When a cloud name is
+// given, that cloud must be known to the azure-cli and is made active if it is
+// not already. The returned func makes the cloud that was active before
+// active again, so that the configuration of the azure-cli is left as it
+// was; it has a context of its own, since it runs once the command is done.
+func (a Az) SelectCloud(ctx context.Context, name string) (Cloud, func(), error) {
+	restore := func() {}
+
+	cloud, err := a.ShowCloud(ctx, name)
+	if err != nil {
+		return Cloud{}, restore, err
+	}
+
+	if !cloud.IsActive {
+		active, err := a.ShowCloud(ctx, "")
+		if err != nil {
+			return Cloud{}, restore, err
+		}
+
+		err = a.setCloud(ctx, cloud.Name)
+		if err != nil {
+			return Cloud{}, restore, err
+		}
+		cloud.IsActive = true
+
+		restore = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+			defer cancel()
+
+			err := a.setCloud(ctx, active.Name)
+			if err != nil {
+				a.logger.Warn(fmt.Sprintf("Failed to make the %s cloud active again. Please run 'az cloud set --name %s'. %s", active.Name, active.Name, err), F("step", "select-cloud"))
+				return
+			}
+			a.logger.Info(fmt.Sprintf("Made the %s cloud active again.", active.Name), F("step", "select-cloud"), F("cloud", active.Name))
+		}
+	}
+
+	a.logger.Info(fmt.Sprintf("Using the %s cloud.", cloud.Name), F("step", "select-cloud"), F("cloud", cloud.Name))
+	return cloud, restore, nil
+}
+
+func (a Az) setCloud(ctx context.Context, name string) error {
+	args := []string{"cloud", "set", "--name", name}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cloud", func() {
+	Describe("environments", func() {
+		It("maps the azure-cli cloud names", func() {
+			cloud := az.Cloud{Name: "AzureUSGovernment"}
+			Expect(cloud.Custom()).To(BeFalse())
+			Expect(cloud.TerraformEnvironment()).To(Equal("usgovernment"))
+			Expect(cloud.SDKEnvironment()).To(Equal("AzureUSGovernmentCloud"))
+
+			cloud = az.Cloud{Name: "AzureChinaCloud"}
+			Expect(cloud.TerraformEnvironment()).To(Equal("china"))
+			Expect(cloud.SDKEnvironment()).To(Equal("AzureChinaCloud"))
+		})
+
+		It("treats registered clouds as azure stack clouds", func() {
+			cloud := az.Cloud{
+				Name:      "MyStack",
+				Endpoints: az.CloudEndpoints{ResourceManager: "https://management.local.azurestack.external/"},
+			}
+			Expect(cloud.Custom()).To(BeTrue())
+			Expect(cloud.TerraformEnvironment()).To(Equal(""))
+			Expect(cloud.SDKEnvironment()).To(Equal("AzureStackCloud"))
+			Expect(cloud.MetadataHost()).To(Equal("management.local.azurestack.external"))
+		})
+
+		It("prefers the microsoft graph endpoint", func() {
+			cloud := az.Cloud{Endpoints: az.CloudEndpoints{
+				ActiveDirectoryGraphResourceId: "https://graph.windows.net/",
+				MicrosoftGraphResourceId:       "https://graph.microsoft.com/",
+			}}
+			Expect(cloud.GraphEndpoint()).To(Equal("https://graph.microsoft.com/"))
+
+			cloud.Endpoints.MicrosoftGraphResourceId = ""
+			Expect(cloud.GraphEndpoint()).To(Equal("https://graph.windows.net/"))
+		})
+	})
+
+	Describe("SelectCloud", func() {
+		var (
+			cli    *fakes.CLI
+			logger *fakes.Logger
+			azure  *az.Az
+		)
+
+		BeforeEach(func() {
+			cli = &fakes.CLI{}
+			logger = &fakes.Logger{}
+			azure = az.NewAz(cli, logger)
+
+			cli.ExecuteCall.Returns.Output = `{
+				"name": "AzureCloud",
+				"isActive": true,
+				"endpoints": {
+					"activeDirectory": "https://login.microsoftonline.com",
+					"resourceManager": "https://management.azure.com/"
+				}
+			}`
+		})
+
+		It("returns the active cloud", func() {
+			cloud, _, err := azure.SelectCloud(context.Background(), "")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"cloud", "show"}))
+			Expect(cloud.Name).To(Equal("AzureCloud"))
+			Expect(cloud.Endpoints.ResourceManager).To(Equal("https://management.azure.com/"))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Using the AzureCloud cloud."))
+		})
+
+		Context("when a cloud that is not active is selected", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Stub = func(args []string) (string, error) {
+					if len(args) == 4 && args[1] == "show" {
+						return `{"name": "AzureUSGovernment", "isActive": false}`, nil
+					}
+					return `{"name": "AzureCloud", "isActive": true}`, nil
+				}
+			})
+
+			It("sets it as the active cloud until it is restored", func() {
+				cloud, restore, err := azure.SelectCloud(context.Background(), "AzureUSGovernment")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.AllArgs).To(Equal([][]string{
+					{"cloud", "show", "--name", "AzureUSGovernment"},
+					{"cloud", "show"},
+					{"cloud", "set", "--name", "AzureUSGovernment"},
+				}))
+				Expect(cloud.IsActive).To(BeTrue())
+
+				restore()
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"cloud", "set", "--name", "AzureCloud"}))
+				Expect(logger.InfoCall.Receives.Message).To(Equal("Made the AzureCloud cloud active again."))
+			})
+		})
+
+		Context("when the selected cloud is not registered", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = "ERROR: The cloud 'MyStack' is not registered."
+				cli.ExecuteCall.Returns.Error = errors.New("exit status 1")
+			})
+
+			It("returns a helpful error", func() {
+				_, _, err := azure.SelectCloud(context.Background(), "MyStack")
+				Expect(err).To(MatchError("The --cloud MyStack is not registered with the azure-cli. Use 'az cloud list' to see your clouds."))
+			})
+		})
+
+		Context("when the azure-cli fails for another reason", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = "ERROR: Failed to establish a new connection."
+				cli.ExecuteCall.Returns.Error = errors.New("exit status 1")
+			})
+
+			It("returns its error", func() {
+				_, _, err := azure.SelectCloud(context.Background(), "MyStack")
+				Expect(err).To(MatchError("Running [cloud show --name MyStack]: ERROR: Failed to establish a new connection."))
+			})
+		})
+
+		Context("when the cloud json is invalid", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `{$$$}`
+			})
+
+			It("returns a helpful error", func() {
+				_, _, err := azure.SelectCloud(context.Background(), "")
+				Expect(err).To(MatchError(ContainSubstring("Unmarshalling cloud json: ")))
+			})
+		})
+	})
+})
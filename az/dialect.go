@@ -0,0 +1,119 @@
+package az
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Dialect is the flavour of the `az ad` commands an azure-cli speaks. Since
+// 2.37.0 they are built on Microsoft Graph, which renamed --homepage to
+// --web-home-page-url, generates client secrets instead of taking a
+// --password, and returns object ids as id rather than objectId.
+type Dialect int
+
+const (
+	AzureADGraph Dialect = iota
+	MicrosoftGraph
+)
+
+func (d Dialect) String() string {
+	if d == MicrosoftGraph {
+		return "Microsoft Graph"
+	}
+	return "Azure AD Graph"
+}
+
+// Dialect returns the dialect of the `az ad` commands of this version.
+func (v CLIVersion) Dialect() Dialect {
+	if v.Supports(FeatureMicrosoftGraph) == nil {
+		return MicrosoftGraph
+	}
+	return AzureADGraph
+}
+
+// WithDialect returns a copy of a that speaks the dialect. NewAz speaks Azure
+// AD Graph.
+func (a Az) WithDialect(d Dialect) *Az {
+	a.dialect = d
+	return &a
+}
+
+// homepageFlag is the flag that sets the home page of an application.
+func (d Dialect) homepageFlag() string {
+	if d == MicrosoftGraph {
+		return "--web-home-page-url"
+	}
+	return "--homepage"
+}
+
+// createApplicationArgs are the arguments that create an application with
+// the password when the dialect takes one. With Microsoft Graph the password
+// is set by a credential reset afterwards.
+func (d Dialect) createApplicationArgs(password, displayName, identifierUri string, endDate time.Time) ([]string, []string) {
+	createArgs := []string{
+		"ad", "app", "create",
+		"--display-name", displayName,
+	}
+	if identifierUri != "" {
+		createArgs = append(createArgs,
+			d.homepageFlag(), identifierUri,
+			"--identifier-uris", identifierUri,
+		)
+	}
+
+	args := createArgs
+	if password != "" && d == AzureADGraph {
+		args = append(args, "--password", password)
+		if !endDate.IsZero() {
+			args = append(args, "--end-date", endDate.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return createArgs, args
+}
+
+// resetPasswordArgs are the arguments that replace the client secrets of the
+// application, or add one to them when keep is set. Microsoft Graph generates
+// the secret rather than taking the password.
+func (d Dialect) resetPasswordArgs(clientId, password string, endDate time.Time, keep bool) ([]string, []string) {
+	resetArgs := []string{
+		"ad", "app", "credential", "reset",
+		"--id", clientId,
+	}
+	if keep {
+		resetArgs = append(resetArgs, "--append")
+	}
+
+	args := resetArgs
+	if d == AzureADGraph {
+		args = append(args, "--password", password)
+	}
+	if !endDate.IsZero() {
+		args = append(args, "--end-date", endDate.UTC().Format(time.RFC3339))
+	}
+
+	return resetArgs, args
+}
+
+// resetPassword returns the client secret in effect after a credential reset
+// that was given the password.
+func (d Dialect) resetPassword(output, password string) (string, error) {
+	if d == AzureADGraph {
+		return password, nil
+	}
+
+	credential := struct {
+		Password string `json:"password"`
+	}{}
+	err := json.Unmarshal([]byte(output), &credential)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unmarshalling credential json: %s", err))
+	}
+	if credential.Password == "" {
+		return "", errors.New("The azure-cli did not return the generated client secret.")
+	}
+
+	return credential.Password, nil
+}
@@ -1,10 +1,20 @@
 package fakes
 
+import (
+	"context"
+	"sync"
+)
+
 type CLI struct {
+	mutex sync.Mutex
+
 	ExecuteCall struct {
 		CallCount int
+		Stub      func(args []string) (string, error)
 		Receives  struct {
-			Args []string
+			Context context.Context
+			Args    []string
+			AllArgs [][]string
 		}
 		Returns struct {
 			Output string
@@ -13,9 +23,18 @@ type CLI struct {
 	}
 }
 
-func (c *CLI) Execute(args []string) (string, error) {
+func (c *CLI) Execute(ctx context.Context, args []string) (string, error) {
+	c.mutex.Lock()
 	c.ExecuteCall.CallCount++
+	c.ExecuteCall.Receives.Context = ctx
 	c.ExecuteCall.Receives.Args = args
+	c.ExecuteCall.Receives.AllArgs = append(c.ExecuteCall.Receives.AllArgs, args)
+	stub := c.ExecuteCall.Stub
+	c.mutex.Unlock()
+
+	if stub != nil {
+		return stub(args)
+	}
 
 	return c.ExecuteCall.Returns.Output, c.ExecuteCall.Returns.Error
 }
@@ -1,15 +1,79 @@
 package fakes
 
+import (
+	"sync"
+
+	"github.com/genevieve/az-automation/az"
+)
+
 type Logger struct {
-	PrintlnCall struct {
+	mutex sync.Mutex
+
+	DebugCall struct {
+		CallCount int
+		Receives  struct {
+			Message string
+			Fields  []az.Field
+		}
+	}
+
+	InfoCall struct {
+		CallCount int
+		Receives  struct {
+			Message string
+			Fields  []az.Field
+		}
+	}
+
+	WarnCall struct {
 		CallCount int
 		Receives  struct {
 			Message string
+			Fields  []az.Field
 		}
 	}
+
+	ErrorCall struct {
+		CallCount int
+		Receives  struct {
+			Message string
+			Fields  []az.Field
+		}
+	}
+}
+
+func (l *Logger) Debug(message string, fields ...az.Field) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.DebugCall.CallCount++
+	l.DebugCall.Receives.Message = message
+	l.DebugCall.Receives.Fields = fields
 }
 
-func (l *Logger) Println(message string) {
-	l.PrintlnCall.CallCount++
-	l.PrintlnCall.Receives.Message = message
+func (l *Logger) Info(message string, fields ...az.Field) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.InfoCall.CallCount++
+	l.InfoCall.Receives.Message = message
+	l.InfoCall.Receives.Fields = fields
+}
+
+func (l *Logger) Warn(message string, fields ...az.Field) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.WarnCall.CallCount++
+	l.WarnCall.Receives.Message = message
+	l.WarnCall.Receives.Fields = fields
+}
+
+func (l *Logger) Error(message string, fields ...az.Field) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ErrorCall.CallCount++
+	l.ErrorCall.Receives.Message = message
+	l.ErrorCall.Receives.Fields = fields
 }
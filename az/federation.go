@@ -0,0 +1,63 @@
+package az
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const defaultFederatedAudience = "api://AzureADTokenExchange"
+
+var federatedIssuers = map[string]string{
+	"github": "https://token.actions.githubusercontent.com",
+	"gitlab": "https://gitlab.com",
+}
+
+type FederatedCredential struct {
+	Name      string   `json:"name"`
+	Issuer    string   `json:"issuer"`
+	Subject   string   `json:"subject"`
+	Audiences []string `json:"audiences"`
+}
+
+// NewFederatedCredential builds a federated identity credential from a preset
+// and the issuer, subject and audience flags. The github and gitlab presets
+// fill in the issuer of the hosted service, while the kubernetes preset takes
+// the cluster's issuer and expands a subject of the form
+// <namespace>/<service-account>.
+func NewFederatedCredential(name, preset, issuer, subject, audience string) (FederatedCredential, error) {
+	switch preset {
+	case "":
+	case "github", "gitlab":
+		if issuer == "" {
+			issuer = federatedIssuers[preset]
+		}
+	case "kubernetes":
+		parts := strings.Split(subject, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return FederatedCredential{}, errors.New("The kubernetes preset requires a --federated-subject of the form <namespace>/<service-account>.")
+		}
+		subject = fmt.Sprintf("system:serviceaccount:%s:%s", parts[0], parts[1])
+	default:
+		return FederatedCredential{}, errors.New(fmt.Sprintf("The --federated-preset %s is not one of github, gitlab or kubernetes.", preset))
+	}
+
+	if issuer == "" {
+		return FederatedCredential{}, errors.New("Please provide a --federated-issuer.")
+	}
+
+	if subject == "" {
+		return FederatedCredential{}, errors.New("Please provide a --federated-subject.")
+	}
+
+	if audience == "" {
+		audience = defaultFederatedAudience
+	}
+
+	return FederatedCredential{
+		Name:      name,
+		Issuer:    issuer,
+		Subject:   subject,
+		Audiences: []string{audience},
+	}, nil
+}
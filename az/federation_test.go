@@ -0,0 +1,71 @@
+package az_test
+
+import (
+	"github.com/genevieve/az-automation/az"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewFederatedCredential", func() {
+	It("uses the github actions issuer for the github preset", func() {
+		credential, err := az.NewFederatedCredential("some-name", "github", "", "repo:some-org/some-repo:ref:refs/heads/main", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(credential).To(Equal(az.FederatedCredential{
+			Name:      "some-name",
+			Issuer:    "https://token.actions.githubusercontent.com",
+			Subject:   "repo:some-org/some-repo:ref:refs/heads/main",
+			Audiences: []string{"api://AzureADTokenExchange"},
+		}))
+	})
+
+	It("uses the gitlab issuer for the gitlab preset", func() {
+		credential, err := az.NewFederatedCredential("some-name", "gitlab", "", "project_path:some-group/some-project:ref_type:branch:ref:main", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(credential.Issuer).To(Equal("https://gitlab.com"))
+	})
+
+	It("allows the preset issuer to be overridden", func() {
+		credential, err := az.NewFederatedCredential("some-name", "gitlab", "https://gitlab.example.com", "some-subject", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(credential.Issuer).To(Equal("https://gitlab.example.com"))
+	})
+
+	It("expands the service account for the kubernetes preset", func() {
+		credential, err := az.NewFederatedCredential("some-name", "kubernetes", "https://oidc.example.com", "some-namespace/some-account", "some-audience")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(credential.Subject).To(Equal("system:serviceaccount:some-namespace:some-account"))
+		Expect(credential.Audiences).To(Equal([]string{"some-audience"}))
+	})
+
+	Context("when the kubernetes subject is not a namespace and service account", func() {
+		It("returns a helpful error", func() {
+			_, err := az.NewFederatedCredential("some-name", "kubernetes", "https://oidc.example.com", "some-account", "")
+			Expect(err).To(MatchError("The kubernetes preset requires a --federated-subject of the form <namespace>/<service-account>."))
+		})
+	})
+
+	Context("when the kubernetes issuer is missing", func() {
+		It("returns a helpful error", func() {
+			_, err := az.NewFederatedCredential("some-name", "kubernetes", "", "some-namespace/some-account", "")
+			Expect(err).To(MatchError("Please provide a --federated-issuer."))
+		})
+	})
+
+	Context("when the subject is missing", func() {
+		It("returns a helpful error", func() {
+			_, err := az.NewFederatedCredential("some-name", "github", "", "", "")
+			Expect(err).To(MatchError("Please provide a --federated-subject."))
+		})
+	})
+
+	Context("when the preset is unknown", func() {
+		It("returns a helpful error", func() {
+			_, err := az.NewFederatedCredential("some-name", "banana", "", "some-subject", "")
+			Expect(err).To(MatchError("The --federated-preset banana is not one of github, gitlab or kubernetes."))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package az
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+type format interface {
+	Render(credentials Credentials) ([]byte, error)
+}
+
+type fileSystem interface {
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// OSFileSystem reads and writes the files of the local filesystem.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+type File struct {
+	path   string
+	format format
+	fs     fileSystem
+	logger logger
+}
+
+func NewFile(path string, format format, fs fileSystem, logger logger) File {
+	return File{
+		path:   path,
+		format: format,
+		fs:     fs,
+		logger: logger,
+	}
+}
+
+func (f File) Write(ctx context.Context, credentials Credentials) error {
+	creds, err := f.format.Render(credentials)
+	if err != nil {
+		return err
+	}
+
+	err = f.fs.WriteFile(f.path, creds, 0600)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing credentials to output file: %s", err))
+	}
+
+	f.logger.Info(fmt.Sprintf("Wrote credentials to %s.", f.path), F("step", "write-credentials"), F("app_id", credentials.ClientId))
+	return nil
+}
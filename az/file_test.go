@@ -0,0 +1,76 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingFormat struct{}
+
+func (failingFormat) Render(credentials az.Credentials) ([]byte, error) {
+	return nil, errors.New("some error")
+}
+
+var _ = Describe("File", func() {
+	var (
+		logger      *fakes.Logger
+		credentials az.Credentials
+
+		file az.File
+	)
+
+	BeforeEach(func() {
+		logger = &fakes.Logger{}
+		credentials = az.Credentials{
+			SubscriptionId: "subscription-id",
+			TenantId:       "tenant-id",
+			ClientId:       "client-id",
+			ClientSecret:   "client-secret",
+		}
+
+		file = az.NewFile("some-credential-file", az.Tfvars{}, az.OSFileSystem{}, logger)
+	})
+
+	AfterEach(func() {
+		os.Remove("some-credential-file")
+	})
+
+	Describe("Write", func() {
+		It("writes the rendered credentials to the specified output file", func() {
+			err := file.Write(context.Background(), credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			bytes, err := ioutil.ReadFile("some-credential-file")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(bytes)).To(ContainSubstring("client_secret = \"client-secret\""))
+
+			info, err := os.Stat("some-credential-file")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Wrote credentials to some-credential-file."))
+		})
+
+		Context("when the credentials cannot be rendered", func() {
+			BeforeEach(func() {
+				file = az.NewFile("some-credential-file", failingFormat{}, az.OSFileSystem{}, logger)
+			})
+
+			It("returns the error and does not write the file", func() {
+				err := file.Write(context.Background(), credentials)
+				Expect(err).To(MatchError("some error"))
+
+				_, err = os.Stat("some-credential-file")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
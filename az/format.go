@@ -0,0 +1,240 @@
+package az
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Tfvars struct{}
+
+func (Tfvars) Render(credentials Credentials) ([]byte, error) {
+	var creds string
+	if credentials.DisplayName != "" {
+		creds = fmt.Sprintf("# Service principal %s\n", credentials.DisplayName)
+	}
+
+	creds += fmt.Sprintf(`subscription_id = "%s"
+tenant_id = "%s"
+client_id = "%s"
+`,
+		credentials.SubscriptionId,
+		credentials.TenantId,
+		credentials.ClientId)
+
+	if credentials.ClientSecret != "" {
+		creds += fmt.Sprintf("client_secret = \"%s\"\n", credentials.ClientSecret)
+	}
+
+	if credentials.FederatedSubject != "" {
+		creds += fmt.Sprintf("use_oidc = true\nfederated_subject = \"%s\"\n", credentials.FederatedSubject)
+	}
+
+	cloud := credentials.Cloud
+	if cloud.Name != "" {
+		if cloud.Custom() {
+			creds += fmt.Sprintf("metadata_host = \"%s\"\n", cloud.MetadataHost())
+		} else {
+			creds += fmt.Sprintf("environment = \"%s\"\n", cloud.TerraformEnvironment())
+		}
+
+		creds += fmt.Sprintf(`resource_manager_endpoint = "%s"
+active_directory_endpoint = "%s"
+graph_endpoint = "%s"
+`,
+			cloud.Endpoints.ResourceManager,
+			cloud.Endpoints.ActiveDirectory,
+			cloud.GraphEndpoint())
+	}
+
+	return []byte(creds), nil
+}
+
+type KubernetesSecret struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+}
+
+// Validate checks the secret has a name.
+func (k KubernetesSecret) Validate() error {
+	if k.Name == "" {
+		return errors.New("Please provide a name for the kubernetes secret.")
+	}
+	return nil
+}
+
+// Render produces a Secret manifest whose data keys match the environment
+// variables read by the Azure SDKs, so it can be used with envFrom.
+func (k KubernetesSecret) Render(credentials Credentials) ([]byte, error) {
+	err := k.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		"AZURE_SUBSCRIPTION_ID": credentials.SubscriptionId,
+		"AZURE_TENANT_ID":       credentials.TenantId,
+		"AZURE_CLIENT_ID":       credentials.ClientId,
+	}
+	if credentials.ClientSecret != "" {
+		data["AZURE_CLIENT_SECRET"] = credentials.ClientSecret
+	}
+	if credentials.FederatedSubject != "" {
+		data["AZURE_FEDERATED_SUBJECT"] = credentials.FederatedSubject
+	}
+	if credentials.Cloud.Name != "" {
+		data["AZURE_ENVIRONMENT"] = credentials.Cloud.SDKEnvironment()
+		data["AZURE_AUTHORITY_HOST"] = credentials.Cloud.Endpoints.ActiveDirectory
+		data["AZURE_RESOURCE_MANAGER_ENDPOINT"] = credentials.Cloud.Endpoints.ResourceManager
+		data["AZURE_GRAPH_ENDPOINT"] = credentials.Cloud.GraphEndpoint()
+	}
+
+	manifest := []string{
+		"apiVersion: v1",
+		"kind: Secret",
+		"type: Opaque",
+		"metadata:",
+		fmt.Sprintf("  name: %s", quote(k.Name)),
+	}
+
+	if k.Namespace != "" {
+		manifest = append(manifest, fmt.Sprintf("  namespace: %s", quote(k.Namespace)))
+	}
+
+	if credentials.DisplayName != "" {
+		manifest = append(manifest, "  annotations:")
+		manifest = append(manifest, fmt.Sprintf("    \"az-automation/display-name\": %s", quote(credentials.DisplayName)))
+	}
+
+	if len(k.Labels) > 0 {
+		manifest = append(manifest, "  labels:")
+		for _, key := range sortedKeys(k.Labels) {
+			manifest = append(manifest, fmt.Sprintf("    %s: %s", quote(key), quote(k.Labels[key])))
+		}
+	}
+
+	manifest = append(manifest, "data:")
+	for _, key := range sortedKeys(data) {
+		manifest = append(manifest, fmt.Sprintf("  %s: %s", key, base64.StdEncoding.EncodeToString([]byte(data[key]))))
+	}
+
+	return []byte(strings.Join(manifest, "\n") + "\n"), nil
+}
+
+type AzureJSON struct {
+	ResourceGroup string
+	Location      string
+}
+
+// Validate checks the azure.json has the resource group and location of the
+// cluster, so that a run can fail before it creates anything.
+func (a AzureJSON) Validate() error {
+	if a.ResourceGroup == "" || a.Location == "" {
+		return errors.New("Please provide a resource group and location for the azure.json.")
+	}
+	return nil
+}
+
+// Render produces the azure.json config read by the kubernetes cloud provider.
+func (a AzureJSON) Render(credentials Credentials) ([]byte, error) {
+	err := a.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	config := struct {
+		Cloud                        string `json:"cloud,omitempty"`
+		ResourceManagerEndpoint      string `json:"resourceManagerEndpoint,omitempty"`
+		ActiveDirectoryAuthorityHost string `json:"activeDirectoryAuthorityHost,omitempty"`
+		GraphEndpoint                string `json:"graphEndpoint,omitempty"`
+		TenantId                     string `json:"tenantId"`
+		SubscriptionId               string `json:"subscriptionId"`
+		AADClientId                  string `json:"aadClientId"`
+		AADClientSecret              string `json:"aadClientSecret,omitempty"`
+		ResourceGroup                string `json:"resourceGroup"`
+		Location                     string `json:"location"`
+	}{
+		TenantId:        credentials.TenantId,
+		SubscriptionId:  credentials.SubscriptionId,
+		AADClientId:     credentials.ClientId,
+		AADClientSecret: credentials.ClientSecret,
+		ResourceGroup:   a.ResourceGroup,
+		Location:        a.Location,
+	}
+
+	// The endpoints are those of the selected cloud, so that the cloud
+	// provider does not fall back to the public cloud for any of them.
+	if cloud := credentials.Cloud; cloud.Name != "" {
+		config.Cloud = cloud.SDKEnvironment()
+		config.ResourceManagerEndpoint = cloud.Endpoints.ResourceManager
+		config.ActiveDirectoryAuthorityHost = cloud.Endpoints.ActiveDirectory
+		config.GraphEndpoint = cloud.GraphEndpoint()
+	}
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Marshalling azure.json: %s", err))
+	}
+
+	return append(output, '\n'), nil
+}
+
+type SDKAuth struct{}
+
+// Render produces the json file read by the Azure SDKs' file based
+// authentication, matching the output of 'az ad sp create-for-rbac --sdk-auth'.
+func (SDKAuth) Render(credentials Credentials) ([]byte, error) {
+	endpoints := credentials.Cloud.Endpoints
+
+	auth := struct {
+		ClientId                       string `json:"clientId"`
+		ClientSecret                   string `json:"clientSecret,omitempty"`
+		SubscriptionId                 string `json:"subscriptionId"`
+		TenantId                       string `json:"tenantId"`
+		ActiveDirectoryEndpointUrl     string `json:"activeDirectoryEndpointUrl"`
+		ResourceManagerEndpointUrl     string `json:"resourceManagerEndpointUrl"`
+		ActiveDirectoryGraphResourceId string `json:"activeDirectoryGraphResourceId"`
+		MicrosoftGraphResourceId       string `json:"microsoftGraphResourceId,omitempty"`
+		SQLManagementEndpointUrl       string `json:"sqlManagementEndpointUrl"`
+		GalleryEndpointUrl             string `json:"galleryEndpointUrl"`
+		ManagementEndpointUrl          string `json:"managementEndpointUrl"`
+	}{
+		ClientId:                       credentials.ClientId,
+		ClientSecret:                   credentials.ClientSecret,
+		SubscriptionId:                 credentials.SubscriptionId,
+		TenantId:                       credentials.TenantId,
+		ActiveDirectoryEndpointUrl:     endpoints.ActiveDirectory,
+		ResourceManagerEndpointUrl:     endpoints.ResourceManager,
+		ActiveDirectoryGraphResourceId: endpoints.ActiveDirectoryGraphResourceId,
+		MicrosoftGraphResourceId:       endpoints.MicrosoftGraphResourceId,
+		SQLManagementEndpointUrl:       endpoints.SQLManagement,
+		GalleryEndpointUrl:             endpoints.Gallery,
+		ManagementEndpointUrl:          endpoints.Management,
+	}
+
+	output, err := json.MarshalIndent(auth, "", "  ")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Marshalling sdk auth json: %s", err))
+	}
+
+	return append(output, '\n'), nil
+}
+
+// quote renders a string as a double quoted yaml scalar.
+func quote(value string) string {
+	output, _ := json.Marshal(value)
+	return string(output)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,312 @@
+package az_test
+
+import (
+	"github.com/genevieve/az-automation/az"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Formats", func() {
+	var credentials az.Credentials
+
+	BeforeEach(func() {
+		credentials = az.Credentials{
+			SubscriptionId: "subscription-id",
+			TenantId:       "tenant-id",
+			ClientId:       "client-id",
+			ClientSecret:   "client-secret",
+		}
+	})
+
+	Describe("Tfvars", func() {
+		It("renders the credentials as terraform variables", func() {
+			output, err := az.Tfvars{}.Render(credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(output)).To(Equal(`subscription_id = "subscription-id"
+tenant_id = "tenant-id"
+client_id = "client-id"
+client_secret = "client-secret"
+`))
+		})
+
+		Context("when the display name is known", func() {
+			BeforeEach(func() {
+				credentials.DisplayName = "some-display-name"
+			})
+
+			It("renders it as a comment", func() {
+				output, err := az.Tfvars{}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(HavePrefix("# Service principal some-display-name\nsubscription_id = "))
+			})
+		})
+
+		Context("when the credentials are federated", func() {
+			BeforeEach(func() {
+				credentials.ClientSecret = ""
+				credentials.FederatedSubject = "repo:some-org/some-repo:ref:refs/heads/main"
+			})
+
+			It("renders the federated subject instead of a client secret", func() {
+				output, err := az.Tfvars{}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(ContainSubstring("use_oidc = true"))
+				Expect(string(output)).To(ContainSubstring("federated_subject = \"repo:some-org/some-repo:ref:refs/heads/main\""))
+				Expect(string(output)).NotTo(ContainSubstring("client_secret"))
+			})
+		})
+
+		Context("when the cloud is known", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name: "AzureUSGovernment",
+					Endpoints: az.CloudEndpoints{
+						ActiveDirectory:          "https://login.microsoftonline.us",
+						ResourceManager:          "https://management.usgovcloudapi.net/",
+						MicrosoftGraphResourceId: "https://graph.microsoft.us/",
+					},
+				}
+			})
+
+			It("renders the environment and endpoints", func() {
+				output, err := az.Tfvars{}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(HaveSuffix(`environment = "usgovernment"
+resource_manager_endpoint = "https://management.usgovcloudapi.net/"
+active_directory_endpoint = "https://login.microsoftonline.us"
+graph_endpoint = "https://graph.microsoft.us/"
+`))
+			})
+		})
+
+		Context("when the cloud is sovereign", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name: "AzureUSGovernment",
+					Endpoints: az.CloudEndpoints{
+						ActiveDirectory:                "https://login.microsoftonline.us",
+						ActiveDirectoryGraphResourceId: "https://graph.windows.net/",
+						MicrosoftGraphResourceId:       "https://graph.microsoft.us/",
+						ResourceManager:                "https://management.usgovcloudapi.net/",
+					},
+				}
+			})
+
+			It("renders the cloud and its endpoints", func() {
+				output, err := az.AzureJSON{ResourceGroup: "some-group", Location: "usgovvirginia"}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(output).To(MatchJSON(`{
+					"cloud": "AzureUSGovernmentCloud",
+					"resourceManagerEndpoint": "https://management.usgovcloudapi.net/",
+					"activeDirectoryAuthorityHost": "https://login.microsoftonline.us",
+					"graphEndpoint": "https://graph.microsoft.us/",
+					"tenantId": "tenant-id",
+					"subscriptionId": "subscription-id",
+					"aadClientId": "client-id",
+					"aadClientSecret": "client-secret",
+					"resourceGroup": "some-group",
+					"location": "usgovvirginia"
+				}`))
+			})
+		})
+
+		Context("when the cloud is custom", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name:      "MyStack",
+					Endpoints: az.CloudEndpoints{ResourceManager: "https://management.local.azurestack.external/"},
+				}
+			})
+
+			It("renders the metadata host instead of an environment", func() {
+				output, err := az.Tfvars{}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(ContainSubstring(`metadata_host = "management.local.azurestack.external"`))
+				Expect(string(output)).NotTo(ContainSubstring("environment ="))
+			})
+		})
+	})
+
+	Describe("KubernetesSecret", func() {
+		It("renders the credentials as a secret manifest", func() {
+			output, err := az.KubernetesSecret{
+				Name:      "azure-credentials",
+				Namespace: "some-namespace",
+				Labels:    map[string]string{"team": "platform", "app": "terraform"},
+			}.Render(credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(string(output)).To(Equal(`apiVersion: v1
+kind: Secret
+type: Opaque
+metadata:
+  name: "azure-credentials"
+  namespace: "some-namespace"
+  labels:
+    "app": "terraform"
+    "team": "platform"
+data:
+  AZURE_CLIENT_ID: Y2xpZW50LWlk
+  AZURE_CLIENT_SECRET: Y2xpZW50LXNlY3JldA==
+  AZURE_SUBSCRIPTION_ID: c3Vic2NyaXB0aW9uLWlk
+  AZURE_TENANT_ID: dGVuYW50LWlk
+`))
+		})
+
+		Context("when the cloud is known", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name:      "AzureChinaCloud",
+					Endpoints: az.CloudEndpoints{ActiveDirectory: "https://login.chinacloudapi.cn"},
+				}
+			})
+
+			It("renders the environment and endpoints", func() {
+				output, err := az.KubernetesSecret{Name: "azure-credentials"}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(ContainSubstring("AZURE_ENVIRONMENT: QXp1cmVDaGluYUNsb3Vk\n"))
+				Expect(string(output)).To(ContainSubstring("AZURE_AUTHORITY_HOST: aHR0cHM6Ly9sb2dpbi5jaGluYWNsb3VkYXBpLmNu\n"))
+			})
+		})
+
+		Context("when the display name is known", func() {
+			BeforeEach(func() {
+				credentials.DisplayName = "some-display-name"
+			})
+
+			It("renders it as an annotation", func() {
+				output, err := az.KubernetesSecret{Name: "azure-credentials"}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(ContainSubstring(`  annotations:
+    "az-automation/display-name": "some-display-name"
+`))
+			})
+		})
+
+		Context("when the name is missing", func() {
+			It("returns a helpful error", func() {
+				_, err := az.KubernetesSecret{}.Render(credentials)
+				Expect(err).To(MatchError("Please provide a name for the kubernetes secret."))
+			})
+		})
+	})
+
+	Describe("AzureJSON", func() {
+		It("renders the credentials as the cloud provider config", func() {
+			output, err := az.AzureJSON{ResourceGroup: "some-group", Location: "westus"}.Render(credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(output).To(MatchJSON(`{
+				"tenantId": "tenant-id",
+				"subscriptionId": "subscription-id",
+				"aadClientId": "client-id",
+				"aadClientSecret": "client-secret",
+				"resourceGroup": "some-group",
+				"location": "westus"
+			}`))
+		})
+
+		Context("when the cloud is custom", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name:      "MyStack",
+					Endpoints: az.CloudEndpoints{ResourceManager: "https://management.local.azurestack.external/"},
+				}
+			})
+
+			It("renders the azure stack cloud and its resource manager endpoint", func() {
+				output, err := az.AzureJSON{ResourceGroup: "some-group", Location: "local"}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(output)).To(ContainSubstring(`"cloud": "AzureStackCloud"`))
+				Expect(string(output)).To(ContainSubstring(`"resourceManagerEndpoint": "https://management.local.azurestack.external/"`))
+			})
+		})
+
+		Context("when the resource group or location is missing", func() {
+			It("returns a helpful error", func() {
+				_, err := az.AzureJSON{Location: "westus"}.Render(credentials)
+				Expect(err).To(MatchError("Please provide a resource group and location for the azure.json."))
+			})
+		})
+	})
+
+	Describe("SDKAuth", func() {
+		BeforeEach(func() {
+			credentials.Cloud = az.Cloud{
+				Name: "AzureCloud",
+				Endpoints: az.CloudEndpoints{
+					ActiveDirectory:                "https://login.microsoftonline.com",
+					ActiveDirectoryGraphResourceId: "https://graph.windows.net/",
+					ResourceManager:                "https://management.azure.com/",
+					Management:                     "https://management.core.windows.net/",
+					SQLManagement:                  "https://management.core.windows.net:8443/",
+					Gallery:                        "https://gallery.azure.com/",
+				},
+			}
+		})
+
+		It("renders the credentials with the endpoints of the cloud", func() {
+			output, err := az.SDKAuth{}.Render(credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(output).To(MatchJSON(`{
+				"clientId": "client-id",
+				"clientSecret": "client-secret",
+				"subscriptionId": "subscription-id",
+				"tenantId": "tenant-id",
+				"activeDirectoryEndpointUrl": "https://login.microsoftonline.com",
+				"resourceManagerEndpointUrl": "https://management.azure.com/",
+				"activeDirectoryGraphResourceId": "https://graph.windows.net/",
+				"sqlManagementEndpointUrl": "https://management.core.windows.net:8443/",
+				"galleryEndpointUrl": "https://gallery.azure.com/",
+				"managementEndpointUrl": "https://management.core.windows.net/"
+			}`))
+		})
+
+		Context("when the cloud is sovereign", func() {
+			BeforeEach(func() {
+				credentials.Cloud = az.Cloud{
+					Name: "AzureUSGovernment",
+					Endpoints: az.CloudEndpoints{
+						ActiveDirectory:                "https://login.microsoftonline.us",
+						ActiveDirectoryGraphResourceId: "https://graph.windows.net/",
+						MicrosoftGraphResourceId:       "https://graph.microsoft.us/",
+						ResourceManager:                "https://management.usgovcloudapi.net/",
+						Management:                     "https://management.core.usgovcloudapi.net/",
+						SQLManagement:                  "https://management.core.usgovcloudapi.net:8443/",
+						Gallery:                        "https://gallery.usgovcloudapi.net/",
+					},
+				}
+			})
+
+			It("renders its AAD, Graph and resource manager endpoints", func() {
+				output, err := az.SDKAuth{}.Render(credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(output).To(MatchJSON(`{
+					"clientId": "client-id",
+					"clientSecret": "client-secret",
+					"subscriptionId": "subscription-id",
+					"tenantId": "tenant-id",
+					"activeDirectoryEndpointUrl": "https://login.microsoftonline.us",
+					"resourceManagerEndpointUrl": "https://management.usgovcloudapi.net/",
+					"activeDirectoryGraphResourceId": "https://graph.windows.net/",
+					"microsoftGraphResourceId": "https://graph.microsoft.us/",
+					"sqlManagementEndpointUrl": "https://management.core.usgovcloudapi.net:8443/",
+					"galleryEndpointUrl": "https://gallery.usgovcloudapi.net/",
+					"managementEndpointUrl": "https://management.core.usgovcloudapi.net/"
+				}`))
+			})
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package az
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const AutoIdentifierUri = "auto"
+
+// ValidateIdentifierUri checks the identifier uri against the default
+// application id uri policy of a tenant: http and https uris must be on one of
+// the tenant's verified domains, and api uris must be scoped to the tenant id
+// or a verified domain, or be the app id itself.
+func ValidateIdentifierUri(identifierUri, tenantId string, verifiedDomains []string) error {
+	u, err := url.Parse(identifierUri)
+	if err != nil || u.Host == "" {
+		return errors.New(fmt.Sprintf("The --identifier-uri %s is not a valid uri.", identifierUri))
+	}
+
+	switch u.Scheme {
+	case "api":
+		path := strings.Trim(u.Path, "/")
+		if strings.EqualFold(u.Host, tenantId) && path != "" {
+			return nil
+		}
+		if onVerifiedDomain(u.Hostname(), verifiedDomains) {
+			return nil
+		}
+		if _, err := uuid.Parse(u.Host); err == nil && path == "" {
+			return nil
+		}
+		return errors.New(fmt.Sprintf("The --identifier-uri %s must be of the form api://%s/<name>, api://<verified domain>/<name> or api://<app id>, or use --identifier-uri auto.", identifierUri, tenantId))
+	case "http", "https":
+		if onVerifiedDomain(u.Hostname(), verifiedDomains) {
+			return nil
+		}
+		return errors.New(fmt.Sprintf("The --identifier-uri %s must be on a verified domain of the tenant (%s), or use --identifier-uri auto.", identifierUri, strings.Join(verifiedDomains, ", ")))
+	default:
+		return errors.New(fmt.Sprintf("The --identifier-uri %s must use the api, http or https scheme, or use --identifier-uri auto.", identifierUri))
+	}
+}
+
+// onVerifiedDomain reports whether the host is one of the verified domains
+// or a subdomain of one.
+func onVerifiedDomain(host string, verifiedDomains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range verifiedDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifiedDomains returns the verified domains of the tenant, which only
+// Microsoft Graph serves.
+func (a Az) VerifiedDomains(ctx context.Context, graphEndpoint string) ([]string, error) {
+	url, err := graphUrl(graphEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"rest",
+		"--method", "get",
+		"--url", fmt.Sprintf("%s/v1.0/domains", url),
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	domains := struct {
+		Value []struct {
+			Id         string `json:"id"`
+			IsVerified bool   `json:"isVerified"`
+		} `json:"value"`
+	}{}
+	err = json.Unmarshal([]byte(output), &domains)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unmarshalling domains json: %s", err))
+	}
+
+	verified := []string{}
+	for _, domain := range domains.Value {
+		if domain.IsVerified {
+			verified = append(verified, domain.Id)
+		}
+	}
+
+	return verified, nil
+}
+
+func (a Az) IdentifierUriExists(ctx context.Context, identifierUri string) error {
+	args := []string{
+		"ad", "app", "list",
+		"--identifier-uri", identifierUri,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	applications := []Application{}
+	err = json.Unmarshal([]byte(output), &applications)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Unmarshalling applications json: %s", err))
+	}
+
+	if len(applications) > 0 {
+		return errors.New(fmt.Sprintf("The --identifier-uri %s is taken by application with id %s.", identifierUri, applications[0].AppId))
+	}
+
+	a.logger.Info(fmt.Sprintf("Confirmed no application already uses identifier uri %s.", identifierUri), F("step", "check-identifier-uri"))
+	return nil
+}
+
+func (a Az) SetIdentifierUri(ctx context.Context, clientId, identifierUri string) error {
+	args := []string{
+		"ad", "app", "update",
+		"--id", clientId,
+		"--identifier-uris", identifierUri,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	a.logger.Info(fmt.Sprintf("Set identifier uri %s.", identifierUri), F("step", "set-identifier-uri"), F("app_id", clientId))
+	return nil
+}
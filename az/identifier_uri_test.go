@@ -0,0 +1,150 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Identifier URI", func() {
+	var (
+		cli    *fakes.CLI
+		logger *fakes.Logger
+		azure  *az.Az
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		logger = &fakes.Logger{}
+		azure = az.NewAz(cli, logger)
+	})
+
+	Describe("ValidateIdentifierUri", func() {
+		domains := []string{"contoso.onmicrosoft.com", "Contoso.com"}
+
+		It("accepts uris on a verified domain or its subdomains", func() {
+			Expect(az.ValidateIdentifierUri("https://contoso.com/terraform", "tenant-id", domains)).To(Succeed())
+			Expect(az.ValidateIdentifierUri("http://terraform.contoso.com", "tenant-id", domains)).To(Succeed())
+			Expect(az.ValidateIdentifierUri("https://contoso.onmicrosoft.com/terraform", "tenant-id", domains)).To(Succeed())
+		})
+
+		It("accepts api uris scoped to the tenant or a verified domain", func() {
+			Expect(az.ValidateIdentifierUri("api://TENANT-ID/terraform", "tenant-id", domains)).To(Succeed())
+			Expect(az.ValidateIdentifierUri("api://contoso.com/terraform", "tenant-id", domains)).To(Succeed())
+		})
+
+		It("accepts the api uri of an app id", func() {
+			Expect(az.ValidateIdentifierUri("api://2b4e1a6c-7a3d-4f5e-9c1b-0d2e3f4a5b6c", "tenant-id", domains)).To(Succeed())
+		})
+
+		It("rejects uris on other domains", func() {
+			err := az.ValidateIdentifierUri("http://example.com", "tenant-id", domains)
+			Expect(err).To(MatchError("The --identifier-uri http://example.com must be on a verified domain of the tenant (contoso.onmicrosoft.com, Contoso.com), or use --identifier-uri auto."))
+
+			err = az.ValidateIdentifierUri("http://notcontoso.com", "tenant-id", domains)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects api uris that are not scoped to the tenant", func() {
+			err := az.ValidateIdentifierUri("api://terraform", "tenant-id", domains)
+			Expect(err).To(MatchError("The --identifier-uri api://terraform must be of the form api://tenant-id/<name>, api://<verified domain>/<name> or api://<app id>, or use --identifier-uri auto."))
+		})
+
+		It("rejects other schemes and invalid uris", func() {
+			err := az.ValidateIdentifierUri("ftp://contoso.com", "tenant-id", domains)
+			Expect(err).To(MatchError("The --identifier-uri ftp://contoso.com must use the api, http or https scheme, or use --identifier-uri auto."))
+
+			err = az.ValidateIdentifierUri("banana", "tenant-id", domains)
+			Expect(err).To(MatchError("The --identifier-uri banana is not a valid uri."))
+		})
+	})
+
+	Describe("VerifiedDomains", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `{"value": [
+				{"id": "contoso.onmicrosoft.com", "isVerified": true},
+				{"id": "unverified.com", "isVerified": false},
+				{"id": "contoso.com", "isVerified": true}
+			]}`
+		})
+
+		It("returns the verified domains of the tenant", func() {
+			domains, err := azure.VerifiedDomains(context.Background(), "https://graph.microsoft.us/")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"rest", "--method", "get", "--url", "https://graph.microsoft.us/v1.0/domains"}))
+			Expect(domains).To(Equal([]string{"contoso.onmicrosoft.com", "contoso.com"}))
+		})
+
+		Context("when the cloud has no Microsoft Graph endpoint", func() {
+			It("returns an error without asking", func() {
+				_, err := azure.VerifiedDomains(context.Background(), "")
+				Expect(err).To(MatchError("The cloud has no Microsoft Graph endpoint."))
+				Expect(cli.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+				cli.ExecuteCall.Returns.Output = "the error message"
+			})
+
+			It("returns a helpful error", func() {
+				_, err := azure.VerifiedDomains(context.Background(), "https://graph.microsoft.com/")
+				Expect(err).To(MatchError("Running [rest --method get --url https://graph.microsoft.com/v1.0/domains]: the error message"))
+			})
+		})
+	})
+
+	Describe("IdentifierUriExists", func() {
+		BeforeEach(func() {
+			cli.ExecuteCall.Returns.Output = `[]`
+		})
+
+		It("returns no error when no application uses the uri", func() {
+			err := azure.IdentifierUriExists(context.Background(), "https://contoso.com/terraform")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "list", "--identifier-uri", "https://contoso.com/terraform"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Confirmed no application already uses identifier uri https://contoso.com/terraform."))
+		})
+
+		Context("when an application uses the uri", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = `[{"displayName": "other", "appId": "1234"}]`
+			})
+
+			It("returns a helpful error", func() {
+				err := azure.IdentifierUriExists(context.Background(), "https://contoso.com/terraform")
+				Expect(err).To(MatchError("The --identifier-uri https://contoso.com/terraform is taken by application with id 1234."))
+			})
+		})
+	})
+
+	Describe("SetIdentifierUri", func() {
+		It("updates the identifier uris of the application", func() {
+			err := azure.SetIdentifierUri(context.Background(), "the-client-id", "api://the-client-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"ad", "app", "update", "--id", "the-client-id", "--identifier-uris", "api://the-client-id"}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Set identifier uri api://the-client-id."))
+		})
+
+		Context("when the cli returns an error", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error", func() {
+				err := azure.SetIdentifierUri(context.Background(), "the-client-id", "api://the-client-id")
+				Expect(err).To(MatchError(ContainSubstring("Running [ad app update --id the-client-id --identifier-uris api://the-client-id]: ")))
+			})
+		})
+	})
+})
@@ -0,0 +1,167 @@
+package az
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var defaultSecretNames = map[string]string{
+	"subscription_id":   "subscription-id",
+	"tenant_id":         "tenant-id",
+	"client_id":         "client-id",
+	"client_secret":     "client-secret",
+	"federated_subject": "federated-subject",
+
+	"environment":               "environment",
+	"resource_manager_endpoint": "resource-manager-endpoint",
+	"active_directory_endpoint": "active-directory-endpoint",
+	"graph_endpoint":            "graph-endpoint",
+}
+
+type KeyVaultConfig struct {
+	Name          string
+	ResourceGroup string
+	Location      string
+	ContentType   string
+	SecretNames   map[string]string
+	Tags          map[string]string
+}
+
+type KeyVault struct {
+	cli    cli
+	logger logger
+	config KeyVaultConfig
+}
+
+func NewKeyVault(cli cli, logger logger, config KeyVaultConfig) KeyVault {
+	return KeyVault{
+		cli:    cli,
+		logger: logger,
+		config: config,
+	}
+}
+
+// Write stores each credential as a secret in the vault. When a resource
+// group is configured the vault is created there if it does not exist yet.
+func (k KeyVault) Write(ctx context.Context, credentials Credentials) error {
+	for key := range k.config.SecretNames {
+		if _, ok := defaultSecretNames[key]; !ok {
+			return errors.New(fmt.Sprintf("The key vault secret name for %s is not one of %s.", key, strings.Join(sortedKeys(defaultSecretNames), ", ")))
+		}
+	}
+
+	if k.config.ResourceGroup != "" {
+		err := k.ensureVault(ctx, credentials.SubscriptionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	secrets := []struct {
+		key   string
+		value string
+	}{
+		{"subscription_id", credentials.SubscriptionId},
+		{"tenant_id", credentials.TenantId},
+		{"client_id", credentials.ClientId},
+		{"client_secret", credentials.ClientSecret},
+		{"federated_subject", credentials.FederatedSubject},
+		{"environment", credentials.Cloud.Name},
+		{"resource_manager_endpoint", credentials.Cloud.Endpoints.ResourceManager},
+		{"active_directory_endpoint", credentials.Cloud.Endpoints.ActiveDirectory},
+		{"graph_endpoint", credentials.Cloud.GraphEndpoint()},
+	}
+
+	for _, secret := range secrets {
+		if secret.value == "" {
+			continue
+		}
+
+		err := k.setSecret(ctx, k.secretName(secret.key), secret.value, credentials)
+		if err != nil {
+			return err
+		}
+	}
+
+	k.logger.Info(fmt.Sprintf("Wrote credentials to key vault %s.", k.config.Name), F("step", "write-credentials"), F("app_id", credentials.ClientId))
+	return nil
+}
+
+func (k KeyVault) ensureVault(ctx context.Context, subscription string) error {
+	_, err := k.cli.Execute(ctx, inSubscription([]string{"keyvault", "show", "--name", k.config.Name}, subscription))
+	if err == nil {
+		return nil
+	}
+
+	args := []string{
+		"keyvault", "create",
+		"--name", k.config.Name,
+		"--resource-group", k.config.ResourceGroup,
+	}
+	if k.config.Location != "" {
+		args = append(args, "--location", k.config.Location)
+	}
+	args = inSubscription(args, subscription)
+
+	output, err := k.cli.Execute(ctx, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	k.logger.Info(fmt.Sprintf("Created key vault %s in resource group %s.", k.config.Name, k.config.ResourceGroup), F("step", "create-key-vault"))
+	return nil
+}
+
+func (k KeyVault) setSecret(ctx context.Context, name, value string, credentials Credentials) error {
+	args := []string{
+		"keyvault", "secret", "set",
+		"--vault-name", k.config.Name,
+		"--name", name,
+	}
+	args = inSubscription(args, credentials.SubscriptionId)
+
+	if k.config.ContentType != "" {
+		args = append(args, "--content-type", k.config.ContentType)
+	}
+
+	if !credentials.ExpiresOn.IsZero() {
+		args = append(args, "--expires", credentials.ExpiresOn.UTC().Format(time.RFC3339))
+	}
+
+	tags := k.tags(credentials)
+	if len(tags) > 0 {
+		args = append(args, "--tags")
+		args = append(args, tags...)
+	}
+
+	output, err := k.cli.Execute(ctx, append(args, "--value", value))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	return nil
+}
+
+func (k KeyVault) secretName(key string) string {
+	if name, ok := k.config.SecretNames[key]; ok {
+		return name
+	}
+	return defaultSecretNames[key]
+}
+
+func (k KeyVault) tags(credentials Credentials) []string {
+	tags := []string{}
+	if _, ok := k.config.Tags["display-name"]; !ok && credentials.DisplayName != "" {
+		tags = append(tags, fmt.Sprintf("display-name=%s", credentials.DisplayName))
+	}
+
+	for key, value := range k.config.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(tags)
+	return tags
+}
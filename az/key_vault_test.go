@@ -0,0 +1,191 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyVault", func() {
+	var (
+		cli         *fakes.CLI
+		logger      *fakes.Logger
+		config      az.KeyVaultConfig
+		credentials az.Credentials
+
+		keyVault az.KeyVault
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		logger = &fakes.Logger{}
+		config = az.KeyVaultConfig{Name: "some-vault"}
+		credentials = az.Credentials{
+			SubscriptionId: "subscription-id",
+			TenantId:       "tenant-id",
+			ClientId:       "client-id",
+			ClientSecret:   "client-secret",
+		}
+	})
+
+	JustBeforeEach(func() {
+		keyVault = az.NewKeyVault(cli, logger, config)
+	})
+
+	Describe("Write", func() {
+		It("sets a secret for each credential", func() {
+			err := keyVault.Write(context.Background(), credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.AllArgs).To(Equal([][]string{
+				{"keyvault", "secret", "set", "--vault-name", "some-vault", "--name", "subscription-id", "--subscription", "subscription-id", "--value", "subscription-id"},
+				{"keyvault", "secret", "set", "--vault-name", "some-vault", "--name", "tenant-id", "--subscription", "subscription-id", "--value", "tenant-id"},
+				{"keyvault", "secret", "set", "--vault-name", "some-vault", "--name", "client-id", "--subscription", "subscription-id", "--value", "client-id"},
+				{"keyvault", "secret", "set", "--vault-name", "some-vault", "--name", "client-secret", "--subscription", "subscription-id", "--value", "client-secret"},
+			}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Wrote credentials to key vault some-vault."))
+		})
+
+		Context("when names, tags, content type and expiry are configured", func() {
+			BeforeEach(func() {
+				config.ContentType = "text/plain"
+				config.SecretNames = map[string]string{"client_secret": "my-secret"}
+				config.Tags = map[string]string{"team": "platform", "env": "prod"}
+				credentials.ExpiresOn = time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+			})
+
+			It("sets them on the secrets", func() {
+				err := keyVault.Write(context.Background(), credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"keyvault", "secret", "set",
+					"--vault-name", "some-vault",
+					"--name", "my-secret",
+					"--subscription", "subscription-id",
+					"--content-type", "text/plain",
+					"--expires", "2019-01-02T03:04:05Z",
+					"--tags", "env=prod", "team=platform",
+					"--value", "client-secret",
+				}))
+			})
+		})
+
+		Context("when the display name is known", func() {
+			BeforeEach(func() {
+				credentials.DisplayName = "some-display-name"
+			})
+
+			It("tags the secrets with it", func() {
+				err := keyVault.Write(context.Background(), credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"keyvault", "secret", "set",
+					"--vault-name", "some-vault",
+					"--name", "client-secret",
+					"--subscription", "subscription-id",
+					"--tags", "display-name=some-display-name",
+					"--value", "client-secret",
+				}))
+			})
+		})
+
+		Context("when a secret name is configured for an unknown credential", func() {
+			BeforeEach(func() {
+				config.SecretNames = map[string]string{"banana": "my-secret"}
+			})
+
+			It("returns a helpful error", func() {
+				err := keyVault.Write(context.Background(), credentials)
+				Expect(err).To(MatchError(ContainSubstring("The key vault secret name for banana is not one of")))
+				Expect(cli.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+
+		Context("when the credentials are federated", func() {
+			BeforeEach(func() {
+				credentials.ClientSecret = ""
+				credentials.FederatedSubject = "some-subject"
+			})
+
+			It("sets the federated subject instead of a client secret", func() {
+				err := keyVault.Write(context.Background(), credentials)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.CallCount).To(Equal(4))
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"keyvault", "secret", "set",
+					"--vault-name", "some-vault", "--name", "federated-subject", "--subscription", "subscription-id", "--value", "some-subject"}))
+			})
+		})
+
+		Context("when a resource group is configured", func() {
+			BeforeEach(func() {
+				config.ResourceGroup = "some-group"
+				config.Location = "westus"
+			})
+
+			Context("and the vault does not exist", func() {
+				BeforeEach(func() {
+					cli.ExecuteCall.Stub = func(args []string) (string, error) {
+						if args[1] == "show" {
+							return "not found", errors.New("some error")
+						}
+						return "", nil
+					}
+				})
+
+				It("creates the vault", func() {
+					err := keyVault.Write(context.Background(), credentials)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(cli.ExecuteCall.Receives.AllArgs[0]).To(Equal([]string{"keyvault", "show", "--name", "some-vault", "--subscription", "subscription-id"}))
+					Expect(cli.ExecuteCall.Receives.AllArgs[1]).To(Equal([]string{"keyvault", "create",
+						"--name", "some-vault",
+						"--resource-group", "some-group",
+						"--location", "westus",
+						"--subscription", "subscription-id",
+					}))
+				})
+			})
+
+			Context("and the vault exists", func() {
+				It("does not create the vault", func() {
+					err := keyVault.Write(context.Background(), credentials)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(cli.ExecuteCall.Receives.AllArgs[0]).To(Equal([]string{"keyvault", "show", "--name", "some-vault", "--subscription", "subscription-id"}))
+					Expect(cli.ExecuteCall.Receives.AllArgs[1][1]).To(Equal("secret"))
+				})
+			})
+
+			Context("and creating the vault fails", func() {
+				BeforeEach(func() {
+					cli.ExecuteCall.Returns.Output = "the error message"
+					cli.ExecuteCall.Returns.Error = errors.New("some error")
+				})
+
+				It("returns a helpful error", func() {
+					err := keyVault.Write(context.Background(), credentials)
+					Expect(err).To(MatchError("Running [keyvault create --name some-vault --resource-group some-group --location westus --subscription subscription-id]: the error message"))
+				})
+			})
+		})
+
+		Context("when setting a secret fails", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Output = "the error message"
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+			})
+
+			It("returns a helpful error without the secret value", func() {
+				err := keyVault.Write(context.Background(), credentials)
+				Expect(err).To(MatchError("Running [keyvault secret set --vault-name some-vault --name subscription-id --subscription subscription-id]: the error message"))
+			})
+		})
+	})
+})
@@ -1,20 +1,175 @@
 package az
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 )
 
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Field is a key and value logged along with a message, such as the app id
+// of the application a step created.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field, for brevity at the call sites.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
 type Logger struct {
 	writer io.Writer
+	level  Level
+	json   bool
+	fields []Field
+	mutex  *sync.Mutex
 }
 
-func NewLogger(writer io.Writer) *Logger {
+// NewLogger writes messages of at least the level to the writer, either as
+// text with the fields as key=value pairs after the message, or with the
+// json format as one object per line.
+func NewLogger(writer io.Writer, level Level, format string) *Logger {
 	return &Logger{
 		writer: writer,
+		level:  level,
+		json:   format == "json",
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// With returns a logger that shares the writer of l and adds the fields to
+// each message, so the output of principals provisioned concurrently can be
+// told apart.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{
+		writer: l.writer,
+		level:  l.level,
+		json:   l.json,
+		fields: append(append([]Field{}, l.fields...), fields...),
+		mutex:  l.mutex,
+	}
+}
+
+func (l *Logger) Debug(message string, fields ...Field) {
+	l.log(LevelDebug, message, fields)
+}
+
+func (l *Logger) Info(message string, fields ...Field) {
+	l.log(LevelInfo, message, fields)
+}
+
+func (l *Logger) Warn(message string, fields ...Field) {
+	l.log(LevelWarn, message, fields)
+}
+
+func (l *Logger) Error(message string, fields ...Field) {
+	l.log(LevelError, message, fields)
+}
+
+func (l *Logger) log(level Level, message string, fields []Field) {
+	if level < l.level {
+		return
+	}
+
+	fields = append(append([]Field{}, l.fields...), fields...)
+
+	var line []byte
+	if l.json {
+		line = jsonLine(time.Now().UTC(), level, message, fields)
+	} else {
+		line = textLine(level, message, fields)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.writer.Write(line)
+}
+
+func textLine(level Level, message string, fields []Field) []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	if level != LevelInfo {
+		fmt.Fprintf(buffer, "%s ", strings.ToUpper(level.String()))
 	}
+	buffer.WriteString(message)
+
+	for _, field := range fields {
+		value := fmt.Sprintf("%v", fieldValue(field.Value))
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(buffer, " %s=%s", field.Key, value)
+	}
+
+	buffer.WriteString("\n")
+	return buffer.Bytes()
 }
 
-func (l *Logger) Println(message string) {
-	fmt.Fprintf(l.writer, "%s\n", message)
+// jsonLine writes the keys in a fixed order, time, level and message first,
+// which a map would not.
+func jsonLine(now time.Time, level Level, message string, fields []Field) []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	buffer.WriteString("{")
+
+	write := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprintf("%v", value))
+		}
+		if buffer.Len() > 1 {
+			buffer.WriteString(",")
+		}
+		buffer.Write(k)
+		buffer.WriteString(":")
+		buffer.Write(v)
+	}
+
+	write("time", now.Format(time.RFC3339Nano))
+	write("level", level.String())
+	write("message", message)
+	for _, field := range fields {
+		write(field.Key, fieldValue(field.Value))
+	}
+
+	buffer.WriteString("}\n")
+	return buffer.Bytes()
+}
+
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case error:
+		return v.Error()
+	default:
+		return v
+	}
 }
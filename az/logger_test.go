@@ -2,6 +2,9 @@ package az_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/genevieve/az-automation/az"
 	. "github.com/onsi/ginkgo"
@@ -9,21 +12,78 @@ import (
 )
 
 var _ = Describe("Logger", func() {
-	var (
-		buffer *bytes.Buffer
-		logger *az.Logger
-	)
+	var buffer *bytes.Buffer
 
 	BeforeEach(func() {
 		buffer = bytes.NewBuffer([]byte{})
-		logger = az.NewLogger(buffer)
 	})
 
-	Describe("Println", func() {
+	Context("with the text format", func() {
+		var logger *az.Logger
+
+		BeforeEach(func() {
+			logger = az.NewLogger(buffer, az.LevelInfo, "text")
+		})
+
 		It("prints out the message", func() {
-			logger.Println("banana")
+			logger.Info("banana")
 
 			Expect(buffer.String()).To(Equal("banana\n"))
 		})
+
+		It("prints the fields after the message", func() {
+			logger.Info("Created application.", az.F("app_id", "1234"), az.F("duration", 1500*time.Millisecond), az.F("subject", "has spaces"))
+
+			Expect(buffer.String()).To(Equal("Created application. app_id=1234 duration=1.5s subject=\"has spaces\"\n"))
+		})
+
+		It("prefixes levels other than info", func() {
+			logger.Warn("Careful.")
+			logger.Error("Failed.", az.F("error", errors.New("some error")))
+
+			Expect(buffer.String()).To(Equal("WARN Careful.\nERROR Failed. error=\"some error\"\n"))
+		})
+
+		It("skips messages below the level", func() {
+			logger.Debug("Hidden.")
+
+			Expect(buffer.String()).To(BeEmpty())
+		})
+
+		Describe("With", func() {
+			It("adds the fields to every message and shares the writer", func() {
+				logger.With(az.F("principal", "team-a")).Info("banana", az.F("app_id", "1234"))
+				logger.Info("apple")
+
+				Expect(buffer.String()).To(Equal("banana principal=team-a app_id=1234\napple\n"))
+			})
+		})
+	})
+
+	Context("with the json format", func() {
+		It("prints one object per message", func() {
+			logger := az.NewLogger(buffer, az.LevelDebug, "json")
+			logger.With(az.F("principal", "team-a")).Debug("Created application.", az.F("app_id", "1234"))
+
+			line := map[string]interface{}{}
+			Expect(json.Unmarshal(buffer.Bytes(), &line)).To(Succeed())
+
+			Expect(line).To(HaveKeyWithValue("level", "debug"))
+			Expect(line).To(HaveKeyWithValue("message", "Created application."))
+			Expect(line).To(HaveKeyWithValue("principal", "team-a"))
+			Expect(line).To(HaveKeyWithValue("app_id", "1234"))
+			Expect(line).To(HaveKey("time"))
+			Expect(buffer.String()).To(HavePrefix(`{"time":`))
+		})
+	})
+
+	Context("when quiet", func() {
+		It("only prints warnings and errors", func() {
+			logger := az.NewLogger(buffer, az.LevelWarn, "text")
+			logger.Info("banana")
+			logger.Warn("apple")
+
+			Expect(buffer.String()).To(Equal("WARN apple\n"))
+		})
 	})
 })
@@ -0,0 +1,58 @@
+package az
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type NameVariables struct {
+	Subscription   string
+	SubscriptionId string
+	Tenant         string
+	User           string
+	Date           string
+	DisplayName    string
+}
+
+func NewNameVariables(account Account, now time.Time) NameVariables {
+	return NameVariables{
+		Subscription:   account.Name,
+		SubscriptionId: account.Id,
+		Tenant:         account.TenantId,
+		User:           account.User.Name,
+		Date:           now.Format("20060102"),
+	}
+}
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+var nameFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"slug": func(s string) string {
+		return strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	},
+}
+
+// RenderName renders a display name or identifier uri template, such as
+// {{slug .Subscription}}-terraform. Names without template actions are
+// returned unchanged.
+func RenderName(name string, variables NameVariables) (string, error) {
+	tmpl, err := template.New("name").Funcs(nameFuncs).Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Parsing name template %s: %s", name, err))
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = tmpl.Execute(buffer, variables)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Rendering name template %s: %s", name, err))
+	}
+
+	return buffer.String(), nil
+}
@@ -0,0 +1,59 @@
+package az_test
+
+import (
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Names", func() {
+	var variables az.NameVariables
+
+	BeforeEach(func() {
+		variables = az.NewNameVariables(az.Account{
+			Name:     "Platform Dev",
+			Id:       "subscription-id",
+			TenantId: "tenant-id",
+			User:     az.AccountUser{Name: "someone@example.com", Type: "user"},
+		}, time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC))
+	})
+
+	Describe("RenderName", func() {
+		It("renders the variables of the account", func() {
+			name, err := az.RenderName("{{slug .Subscription}}-{{.Date}}-{{.Tenant}}-{{.SubscriptionId}}", variables)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("platform-dev-20190102-tenant-id-subscription-id"))
+		})
+
+		It("renders the user and display name", func() {
+			variables.DisplayName = "some-app"
+
+			name, err := az.RenderName("https://contoso.com/{{.DisplayName}}/{{slug .User}}", variables)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("https://contoso.com/some-app/someone-example-com"))
+		})
+
+		It("returns names without actions unchanged", func() {
+			name, err := az.RenderName("some-display-name", variables)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("some-display-name"))
+		})
+
+		Context("when the template is invalid", func() {
+			It("returns a helpful error", func() {
+				_, err := az.RenderName("{{.Subscription", variables)
+				Expect(err).To(MatchError(ContainSubstring("Parsing name template {{.Subscription: ")))
+			})
+		})
+
+		Context("when the template uses an unknown variable", func() {
+			It("returns a helpful error", func() {
+				_, err := az.RenderName("{{.Banana}}", variables)
+				Expect(err).To(MatchError(ContainSubstring("Rendering name template {{.Banana}}: ")))
+			})
+		})
+	})
+})
@@ -0,0 +1,191 @@
+package az
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplicationCreatorRoles are the directory roles that may register
+// applications even when users of the tenant may not.
+var ApplicationCreatorRoles = []string{
+	"Global Administrator",
+	"Company Administrator",
+	"Application Administrator",
+	"Cloud Application Administrator",
+	"Application Developer",
+}
+
+// RoleAssignmentWriterRoles are the built in roles that may assign roles.
+var RoleAssignmentWriterRoles = []string{
+	"Owner",
+	"User Access Administrator",
+	"Role Based Access Control Administrator",
+}
+
+// AccessTokenExpiry returns when the access token of the azure-cli for the
+// account expires. Signing in again is needed once its refresh token has
+// expired too, which fails here.
+func (a Az) AccessTokenExpiry(ctx context.Context, subscriptionId string) (time.Time, error) {
+	args := []string{
+		"account", "get-access-token",
+		"--subscription", subscriptionId,
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	token := struct {
+		ExpiresOn    string      `json:"expiresOn"`
+		ExpiresOnUTC json.Number `json:"expires_on"`
+	}{}
+	err = json.Unmarshal([]byte(output), &token)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Unmarshalling access token json: %s", err))
+	}
+
+	// Newer versions of the azure-cli add the expiry as a unix timestamp;
+	// older ones only have it in local time.
+	if seconds, err := strconv.ParseInt(string(token.ExpiresOnUTC), 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	expiresOn, err := time.ParseInLocation("2006-01-02 15:04:05.999999", token.ExpiresOn, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("The expiry %s of the access token could not be parsed.", token.ExpiresOn))
+	}
+	return expiresOn, nil
+}
+
+// DirectoryRoles returns the names of the directory roles of the signed-in
+// user, including those held through groups, reading every page of its
+// memberships from Microsoft Graph.
+func (a Az) DirectoryRoles(ctx context.Context, graphEndpoint string) ([]string, error) {
+	url, err := graphUrl(graphEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	url = fmt.Sprintf("%s/v1.0/me/transitiveMemberOf", url)
+
+	roles := []string{}
+	for url != "" {
+		args := []string{
+			"rest",
+			"--method", "get",
+			"--url", url,
+		}
+
+		output, err := a.cli.Execute(ctx, args)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+		}
+
+		memberOf := struct {
+			Value []struct {
+				Type        string `json:"@odata.type"`
+				DisplayName string `json:"displayName"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}{}
+		err = json.Unmarshal([]byte(output), &memberOf)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Unmarshalling directory roles json: %s", err))
+		}
+
+		for _, member := range memberOf.Value {
+			if member.Type == "#microsoft.graph.directoryRole" {
+				roles = append(roles, member.DisplayName)
+			}
+		}
+		url = memberOf.NextLink
+	}
+
+	return roles, nil
+}
+
+// UsersCanCreateApplications reports whether the authorization policy of the
+// tenant lets any user register applications.
+func (a Az) UsersCanCreateApplications(ctx context.Context, graphEndpoint string) (bool, error) {
+	url, err := graphUrl(graphEndpoint)
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{
+		"rest",
+		"--method", "get",
+		"--url", fmt.Sprintf("%s/v1.0/policies/authorizationPolicy", url),
+	}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	policy := struct {
+		DefaultUserRolePermissions struct {
+			AllowedToCreateApps bool `json:"allowedToCreateApps"`
+		} `json:"defaultUserRolePermissions"`
+	}{}
+	err = json.Unmarshal([]byte(output), &policy)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Unmarshalling authorization policy json: %s", err))
+	}
+
+	return policy.DefaultUserRolePermissions.AllowedToCreateApps, nil
+}
+
+// RoleAssignmentsAt returns the role assignments that apply to the assignee
+// at the scope, including those inherited from parent scopes and those of
+// its groups.
+func (a Az) RoleAssignmentsAt(ctx context.Context, assignee, scope string) ([]RoleAssignment, error) {
+	args := []string{
+		"role", "assignment", "list",
+		"--assignee", assignee,
+		"--scope", scope,
+		"--include-inherited",
+		"--include-groups",
+	}
+	args = a.inSubscription(args)
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	assignments := []RoleAssignment{}
+	err = json.Unmarshal([]byte(output), &assignments)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unmarshalling role assignments json: %s", err))
+	}
+
+	return assignments, nil
+}
+
+// HasRole returns the first of the roles found among the names, ignoring
+// case.
+func HasRole(names []string, roles []string) (string, bool) {
+	for _, role := range roles {
+		for _, name := range names {
+			if strings.EqualFold(name, role) {
+				return role, true
+			}
+		}
+	}
+	return "", false
+}
+
+// graphUrl is the Microsoft Graph endpoint without its trailing slash. A
+// cloud the azure-cli knows no Microsoft Graph endpoint for cannot be asked.
+func graphUrl(graphEndpoint string) (string, error) {
+	if graphEndpoint == "" {
+		return "", errors.New("The cloud has no Microsoft Graph endpoint.")
+	}
+	return strings.TrimSuffix(graphEndpoint, "/"), nil
+}
@@ -0,0 +1,144 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Permissions", func() {
+	var (
+		cli    *fakes.CLI
+		logger *fakes.Logger
+		azure  *az.Az
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		logger = &fakes.Logger{}
+		azure = az.NewAz(cli, logger)
+	})
+
+	Describe("AccessTokenExpiry", func() {
+		It("returns the unix expiry of the access token", func() {
+			cli.ExecuteCall.Returns.Output = `{"expiresOn": "2020-01-01 01:00:00.000000", "expires_on": 1577840400}`
+
+			expiry, err := azure.AccessTokenExpiry(context.Background(), "some-subscription-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "get-access-token", "--subscription", "some-subscription-id"}))
+			Expect(expiry.UTC()).To(Equal(time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)))
+		})
+
+		Context("when the azure-cli only has the local expiry", func() {
+			It("parses it in local time", func() {
+				cli.ExecuteCall.Returns.Output = `{"expiresOn": "2020-01-01 01:00:00.123456"}`
+
+				expiry, err := azure.AccessTokenExpiry(context.Background(), "some-subscription-id")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(expiry).To(Equal(time.Date(2020, 1, 1, 1, 0, 0, 123456000, time.Local)))
+			})
+		})
+
+		Context("when the token cannot be refreshed", func() {
+			It("returns an error", func() {
+				cli.ExecuteCall.Returns.Output = "AADSTS700082: The refresh token has expired."
+				cli.ExecuteCall.Returns.Error = errors.New("exit status 1")
+
+				_, err := azure.AccessTokenExpiry(context.Background(), "some-subscription-id")
+				Expect(err).To(MatchError(ContainSubstring("The refresh token has expired.")))
+			})
+		})
+	})
+
+	Describe("DirectoryRoles", func() {
+		It("returns the directory roles among the groups and roles of the user", func() {
+			cli.ExecuteCall.Returns.Output = `{"value": [
+				{"@odata.type": "#microsoft.graph.group", "displayName": "some-group"},
+				{"@odata.type": "#microsoft.graph.directoryRole", "displayName": "Application Developer"}
+			]}`
+
+			roles, err := azure.DirectoryRoles(context.Background(), "https://graph.microsoft.com/")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"rest", "--method", "get", "--url", "https://graph.microsoft.com/v1.0/me/transitiveMemberOf"}))
+			Expect(roles).To(Equal([]string{"Application Developer"}))
+		})
+
+		Context("when the memberships span several pages", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Stub = func(args []string) (string, error) {
+					if args[4] == "https://graph.microsoft.com/v1.0/me/transitiveMemberOf" {
+						return `{"value": [{"@odata.type": "#microsoft.graph.group", "displayName": "some-group"}],
+							"@odata.nextLink": "https://graph.microsoft.com/v1.0/me/transitiveMemberOf?$skiptoken=some-token"}`, nil
+					}
+					return `{"value": [{"@odata.type": "#microsoft.graph.directoryRole", "displayName": "Application Administrator"}]}`, nil
+				}
+			})
+
+			It("follows the next links", func() {
+				roles, err := azure.DirectoryRoles(context.Background(), "https://graph.microsoft.com/")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.CallCount).To(Equal(2))
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"rest", "--method", "get", "--url", "https://graph.microsoft.com/v1.0/me/transitiveMemberOf?$skiptoken=some-token"}))
+				Expect(roles).To(Equal([]string{"Application Administrator"}))
+			})
+		})
+
+		Context("when the cloud has no Microsoft Graph endpoint", func() {
+			It("returns an error without asking", func() {
+				_, err := azure.DirectoryRoles(context.Background(), "")
+				Expect(err).To(MatchError("The cloud has no Microsoft Graph endpoint."))
+				Expect(cli.ExecuteCall.CallCount).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("UsersCanCreateApplications", func() {
+		It("reads the authorization policy of the tenant", func() {
+			cli.ExecuteCall.Returns.Output = `{"defaultUserRolePermissions": {"allowedToCreateApps": true}}`
+
+			allowed, err := azure.UsersCanCreateApplications(context.Background(), "https://graph.microsoft.com/")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"rest", "--method", "get", "--url", "https://graph.microsoft.com/v1.0/policies/authorizationPolicy"}))
+			Expect(allowed).To(BeTrue())
+		})
+	})
+
+	Describe("RoleAssignmentsAt", func() {
+		It("includes inherited and group assignments", func() {
+			cli.ExecuteCall.Returns.Output = `[{"id": "some-id", "roleDefinitionName": "Owner", "scope": "/subscriptions/some-subscription-id"}]`
+
+			assignments, err := azure.RoleAssignmentsAt(context.Background(), "someone@example.com", "/subscriptions/some-subscription-id/resourceGroups/some-group")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{
+				"role", "assignment", "list",
+				"--assignee", "someone@example.com",
+				"--scope", "/subscriptions/some-subscription-id/resourceGroups/some-group",
+				"--include-inherited",
+				"--include-groups",
+			}))
+			Expect(assignments).To(Equal([]az.RoleAssignment{{Id: "some-id", RoleDefinitionName: "Owner", Scope: "/subscriptions/some-subscription-id"}}))
+		})
+	})
+
+	Describe("HasRole", func() {
+		It("finds the roles ignoring case", func() {
+			role, ok := az.HasRole([]string{"Reader", "owner"}, az.RoleAssignmentWriterRoles)
+			Expect(ok).To(BeTrue())
+			Expect(role).To(Equal("Owner"))
+
+			_, ok = az.HasRole([]string{"Contributor"}, az.RoleAssignmentWriterRoles)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
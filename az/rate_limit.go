@@ -0,0 +1,53 @@
+package az
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type RateLimitedCLI struct {
+	cli      cli
+	interval time.Duration
+	mutex    *sync.Mutex
+	next     time.Time
+}
+
+// NewRateLimitedCLI spaces out the commands executed by cli so that no more
+// than callsPerSecond start each second, however many goroutines share it.
+// This keeps a batch of principals from being throttled by Azure AD. A rate
+// of zero or less does not limit the commands.
+func NewRateLimitedCLI(cli cli, callsPerSecond float64) *RateLimitedCLI {
+	var interval time.Duration
+	if callsPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / callsPerSecond)
+	}
+
+	return &RateLimitedCLI{
+		cli:      cli,
+		interval: interval,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+func (r *RateLimitedCLI) Execute(ctx context.Context, args []string) (string, error) {
+	r.mutex.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mutex.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return "The azure-cli was interrupted.", ctx.Err()
+	}
+
+	return r.cli.Execute(ctx, args)
+}
@@ -0,0 +1,76 @@
+package az_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimitedCLI", func() {
+	var cli *fakes.CLI
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		cli.ExecuteCall.Returns.Output = "some-output"
+	})
+
+	Describe("Execute", func() {
+		It("spaces out the commands of concurrent callers", func() {
+			limited := az.NewRateLimitedCLI(cli, 50)
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					output, err := limited.Execute(context.Background(), []string{"account", "list"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(output).To(Equal("some-output"))
+				}()
+			}
+			wg.Wait()
+
+			Expect(cli.ExecuteCall.CallCount).To(Equal(5))
+			Expect(time.Since(start)).To(BeNumerically(">=", 80*time.Millisecond))
+		})
+
+		Context("when the context is done while waiting", func() {
+			It("returns without executing the command", func() {
+				limited := az.NewRateLimitedCLI(cli, 1)
+				_, err := limited.Execute(context.Background(), []string{"account", "list"})
+				Expect(err).NotTo(HaveOccurred())
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+
+				_, err = limited.Execute(ctx, []string{"account", "list"})
+				Expect(err).To(Equal(context.DeadlineExceeded))
+				Expect(cli.ExecuteCall.CallCount).To(Equal(1))
+			})
+		})
+
+		Context("when there is no limit", func() {
+			It("executes the commands right away", func() {
+				limited := az.NewRateLimitedCLI(cli, 0)
+
+				start := time.Now()
+				for i := 0; i < 5; i++ {
+					_, err := limited.Execute(context.Background(), []string{"account", "list"})
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				Expect(cli.ExecuteCall.CallCount).To(Equal(5))
+				Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+			})
+		})
+	})
+})
@@ -0,0 +1,162 @@
+package az
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceOutputLimit is how much of the output of a command is logged. The
+// trace file always gets all of it.
+const traceOutputLimit = 512
+
+const redacted = "REDACTED"
+
+// secretFlags are the azure-cli flags whose values are never logged.
+var secretFlags = map[string]bool{
+	"--password":      true,
+	"--value":         true,
+	"--secret":        true,
+	"--client-secret": true,
+}
+
+type TracedCLI struct {
+	cli    cli
+	logger logger
+	trace  io.Writer
+	mutex  *sync.Mutex
+}
+
+type traceEntry struct {
+	Time     time.Time `json:"time"`
+	Args     []string  `json:"args"`
+	ExitCode int       `json:"exit_code"`
+	Duration string    `json:"duration"`
+	Output   string    `json:"output"`
+}
+
+// NewTracedCLI logs every command executed by cli at debug level, with its
+// exit code, duration and the start of its output, and writes the whole
+// output to trace unless it is nil. The values of secret flags are redacted,
+// in the arguments and wherever they show up in the output, as are the
+// secrets the azure-cli generates.
+func NewTracedCLI(cli cli, logger logger, trace io.Writer) *TracedCLI {
+	return &TracedCLI{
+		cli:    cli,
+		logger: logger,
+		trace:  trace,
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (t *TracedCLI) Execute(ctx context.Context, args []string) (string, error) {
+	start := time.Now()
+	output, err := t.cli.Execute(ctx, args)
+	duration := time.Since(start)
+
+	redactedArgs, secrets := redact(args)
+	tracedOutput := redactOutput(output, secrets)
+	code := exitCode(err)
+
+	t.logger.Debug("Ran azure-cli command.",
+		F("step", "az"),
+		F("args", strings.Join(redactedArgs, " ")),
+		F("exit_code", code),
+		F("duration", duration),
+		F("output", truncate(tracedOutput, traceOutputLimit)),
+	)
+
+	if t.trace != nil {
+		t.write(traceEntry{
+			Time:     start.UTC(),
+			Args:     redactedArgs,
+			ExitCode: code,
+			Duration: duration.String(),
+			Output:   tracedOutput,
+		})
+	}
+
+	return output, err
+}
+
+// write appends the entry to the trace. A trace that cannot be written is
+// reported but does not fail the command.
+func (t *TracedCLI) write(entry traceEntry) {
+	line, err := json.Marshal(entry)
+	if err == nil {
+		t.mutex.Lock()
+		_, err = t.trace.Write(append(line, '\n'))
+		t.mutex.Unlock()
+	}
+	if err != nil {
+		t.logger.Warn(fmt.Sprintf("Failed to write the trace: %s", err), F("step", "az"))
+	}
+}
+
+// redact returns a copy of args without the values of secret flags, given
+// either as --flag value or --flag=value, and the values it removed.
+func redact(args []string) ([]string, []string) {
+	var secrets []string
+	result := make([]string, len(args))
+	copy(result, args)
+
+	for i := 0; i < len(result); i++ {
+		flag := result[i]
+		if j := strings.Index(flag, "="); j > 0 && secretFlags[flag[:j]] {
+			if value := flag[j+1:]; value != "" {
+				secrets = append(secrets, value)
+			}
+			result[i] = flag[:j+1] + redacted
+			continue
+		}
+
+		if secretFlags[flag] && i+1 < len(result) {
+			if result[i+1] != "" {
+				secrets = append(secrets, result[i+1])
+			}
+			result[i+1] = redacted
+			i++
+		}
+	}
+
+	return result, secrets
+}
+
+// generatedSecret is a secret in the json printed by the azure-cli, such as
+// the client secret generated by a credential reset or the access token of
+// the signed-in user.
+var generatedSecret = regexp.MustCompile(`("(?:password|secretText|accessToken|access_token|refreshToken|refresh_token|token)"\s*:\s*")[^"]*(")`)
+
+// redactOutput returns the output without the secrets or any generated
+// secret.
+func redactOutput(output string, secrets []string) string {
+	for _, secret := range secrets {
+		output = strings.Replace(output, secret, redacted, -1)
+	}
+	return generatedSecret.ReplaceAllString(output, "${1}"+redacted+"${2}")
+}
+
+// exitCode is the exit code carried by the error of a command, such as an
+// *exec.ExitError or ExitError, or -1 when it did not exit by itself.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func truncate(s string, limit int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= limit {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", s[:limit], len(s)-limit)
+}
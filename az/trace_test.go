@@ -0,0 +1,142 @@
+package az_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TracedCLI", func() {
+	var (
+		cli    *fakes.CLI
+		logger *fakes.Logger
+		trace  *bytes.Buffer
+		traced *az.TracedCLI
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		logger = &fakes.Logger{}
+		trace = &bytes.Buffer{}
+		traced = az.NewTracedCLI(cli, logger, trace)
+	})
+
+	field := func(fields []az.Field, key string) interface{} {
+		for _, f := range fields {
+			if f.Key == key {
+				return f.Value
+			}
+		}
+		return nil
+	}
+
+	Describe("Execute", func() {
+		It("executes the command and logs it at debug level", func() {
+			cli.ExecuteCall.Returns.Output = "some-output"
+
+			output, err := traced.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal("some-output"))
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "list"}))
+			Expect(logger.DebugCall.CallCount).To(Equal(1))
+			Expect(logger.DebugCall.Receives.Message).To(Equal("Ran azure-cli command."))
+
+			fields := logger.DebugCall.Receives.Fields
+			Expect(field(fields, "args")).To(Equal("account list"))
+			Expect(field(fields, "exit_code")).To(Equal(0))
+			Expect(field(fields, "output")).To(Equal("some-output"))
+			Expect(field(fields, "duration")).NotTo(BeNil())
+		})
+
+		It("logs the exit code of a replayed failure", func() {
+			cli.ExecuteCall.Returns.Output = "some-error"
+			cli.ExecuteCall.Returns.Error = az.ExitError{Code: 2}
+
+			_, err := traced.Execute(context.Background(), []string{"account", "list"})
+			Expect(err).To(HaveOccurred())
+
+			Expect(field(logger.DebugCall.Receives.Fields, "exit_code")).To(Equal(2))
+		})
+
+		It("redacts secret flags in the arguments, output and trace", func() {
+			cli.ExecuteCall.Returns.Output = `{"password": "some-password"}`
+
+			output, err := traced.Execute(context.Background(), []string{
+				"ad", "app", "credential", "reset", "--id", "some-id", "--password", "some-password", "--value=some-value",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(Equal(`{"password": "some-password"}`))
+			Expect(cli.ExecuteCall.Receives.Args).To(ContainElement("some-password"))
+
+			fields := logger.DebugCall.Receives.Fields
+			Expect(field(fields, "args")).To(Equal("ad app credential reset --id some-id --password REDACTED --value=REDACTED"))
+			Expect(field(fields, "output")).To(Equal(`{"password": "REDACTED"}`))
+
+			Expect(trace.String()).NotTo(ContainSubstring("some-password"))
+			Expect(trace.String()).NotTo(ContainSubstring("some-value"))
+		})
+
+		It("redacts access tokens in the output and trace", func() {
+			cli.ExecuteCall.Returns.Output = `{"accessToken": "some-token", "refreshToken": "some-refresh-token", "tokenType": "Bearer"}`
+
+			_, err := traced.Execute(context.Background(), []string{"account", "get-access-token"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(field(logger.DebugCall.Receives.Fields, "output")).To(Equal(`{"accessToken": "REDACTED", "refreshToken": "REDACTED", "tokenType": "Bearer"}`))
+			Expect(trace.String()).NotTo(ContainSubstring("some-token"))
+			Expect(trace.String()).NotTo(ContainSubstring("some-refresh-token"))
+		})
+
+		It("truncates long output in the log but not in the trace", func() {
+			cli.ExecuteCall.Returns.Output = strings.Repeat("a", 1000)
+
+			_, err := traced.Execute(context.Background(), []string{"ad", "app", "list"})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(field(logger.DebugCall.Receives.Fields, "output")).To(Equal(strings.Repeat("a", 512) + "... (488 more bytes)"))
+
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(trace.Bytes(), &entry)).To(Succeed())
+			Expect(entry["output"]).To(Equal(strings.Repeat("a", 1000)))
+			Expect(entry["args"]).To(Equal([]interface{}{"ad", "app", "list"}))
+			Expect(entry).To(HaveKey("time"))
+			Expect(entry).To(HaveKey("duration"))
+		})
+
+		Context("when the command fails", func() {
+			It("returns the error and traces the failure", func() {
+				cli.ExecuteCall.Returns.Output = "some-stderr"
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+
+				output, err := traced.Execute(context.Background(), []string{"account", "show"})
+				Expect(err).To(MatchError("some error"))
+				Expect(output).To(Equal("some-stderr"))
+
+				fields := logger.DebugCall.Receives.Fields
+				Expect(field(fields, "exit_code")).To(Equal(-1))
+				Expect(field(fields, "output")).To(Equal("some-stderr"))
+				Expect(trace.String()).To(ContainSubstring(`"exit_code":-1`))
+			})
+		})
+
+		Context("when there is no trace", func() {
+			It("only logs the command", func() {
+				traced = az.NewTracedCLI(cli, logger, nil)
+
+				_, err := traced.Execute(context.Background(), []string{"account", "list"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logger.DebugCall.CallCount).To(Equal(1))
+				Expect(logger.WarnCall.CallCount).To(Equal(0))
+			})
+		})
+	})
+})
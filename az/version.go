@@ -0,0 +1,151 @@
+package az
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	semver "github.com/hashicorp/go-version"
+)
+
+// MinimumVersion is the oldest azure-cli az-automation runs with.
+const MinimumVersion = "2.0.0"
+
+// CLIVersion is the version of the azure-cli and of its extensions.
+type CLIVersion struct {
+	Core       string            `json:"core"`
+	Extensions map[string]string `json:"extensions"`
+}
+
+// Feature is something az-automation does that needs a newer azure-cli than
+// the MinimumVersion.
+type Feature struct {
+	Name    string
+	Version string
+}
+
+var (
+	// FeatureRest reads Microsoft Graph with `az rest`, to find the verified
+	// domains and check permissions.
+	FeatureRest = Feature{Name: "Calling Microsoft Graph with 'az rest'", Version: "2.0.67"}
+
+	// FeatureMicrosoftGraph is the `az ad` commands built on Microsoft Graph
+	// rather than Azure AD Graph.
+	FeatureMicrosoftGraph = Feature{Name: "Using the Microsoft Graph 'az ad' commands", Version: "2.37.0"}
+
+	// FeatureFederatedCredentials is `az ad app federated-credential`.
+	FeatureFederatedCredentials = Feature{Name: "Creating federated credentials", Version: "2.37.0"}
+)
+
+// Supports returns an error naming the feature when the azure-cli is too old
+// for it.
+func (v CLIVersion) Supports(feature Feature) error {
+	curr, err := semver.NewVersion(v.Core)
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s needs azure-cli %s or later, but the version of the azure-cli is not known.", feature.Name, feature.Version))
+	}
+
+	min, _ := semver.NewVersion(feature.Version)
+	if curr.LessThan(min) {
+		return errors.New(fmt.Sprintf("%s needs azure-cli %s or later, but %s is installed. Please update the azure-cli.", feature.Name, feature.Version, v.Core))
+	}
+	return nil
+}
+
+func (a Az) ValidVersion(ctx context.Context) error {
+	_, err := a.Version(ctx)
+	return err
+}
+
+// Version returns the version of the azure-cli and its extensions, once it is
+// known to be at least the MinimumVersion. It is read from `az version`, or
+// from `az -v` on azure-cli older than 2.11.0, which has no such command.
+func (a Az) Version(ctx context.Context) (CLIVersion, error) {
+	version, err := a.versionJson(ctx)
+	if err != nil {
+		a.logger.Debug("Falling back to 'az -v' for the version of the azure-cli.", F("step", "check-version"), F("error", err.Error()))
+
+		output, err := a.cli.Execute(ctx, []string{"-v"})
+		if err != nil {
+			return CLIVersion{}, errors.New("Please install the azure-cli.")
+		}
+		version = parseVersionText(output)
+	}
+
+	curr, err := semver.NewVersion(version.Core)
+	if err != nil {
+		return CLIVersion{}, errors.New("The azure-cli version could not be parsed.")
+	}
+
+	min, _ := semver.NewVersion(MinimumVersion)
+
+	if curr.LessThan(min) {
+		return CLIVersion{}, errors.New(fmt.Sprintf("Please update the azure-cli to at least %s.", MinimumVersion))
+	}
+
+	a.logger.Info(fmt.Sprintf("Checked version of azure-cli is above %s.", MinimumVersion), F("step", "check-version"), F("version", version.Core))
+	return version, nil
+}
+
+func (a Az) versionJson(ctx context.Context) (CLIVersion, error) {
+	args := []string{"version", "--output", "json"}
+
+	output, err := a.cli.Execute(ctx, args)
+	if err != nil {
+		return CLIVersion{}, errors.New(fmt.Sprintf("Running %+v: %s", args, output))
+	}
+
+	versions := struct {
+		Core       string            `json:"azure-cli"`
+		Extensions map[string]string `json:"extensions"`
+	}{}
+	err = json.Unmarshal([]byte(output), &versions)
+	if err != nil {
+		return CLIVersion{}, errors.New(fmt.Sprintf("Unmarshalling version json: %s", err))
+	}
+	if versions.Core == "" {
+		return CLIVersion{}, errors.New("The version json has no azure-cli version.")
+	}
+
+	return CLIVersion{Core: versions.Core, Extensions: versions.Extensions}, nil
+}
+
+var (
+	versionNumber      = regexp.MustCompile(`\d+\.\d+\.\d+`)
+	coreVersionLine    = regexp.MustCompile(`(?m)^azure-cli\s+(\d+\.\d+\.\d+)`)
+	packageVersionLine = regexp.MustCompile(`^(\S+)\s+(\d+\.\d+\.\d+)`)
+)
+
+// parseVersionText reads the output of `az -v`, which lists the azure-cli,
+// its modules, its extensions and python, each with their version.
+func parseVersionText(output string) CLIVersion {
+	version := CLIVersion{Extensions: map[string]string{}}
+
+	if match := coreVersionLine.FindStringSubmatch(output); match != nil {
+		version.Core = match[1]
+	} else {
+		version.Core = versionNumber.FindString(output)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	extensions := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "Extensions:":
+			extensions = true
+		case line == "":
+			extensions = false
+		case extensions:
+			if match := packageVersionLine.FindStringSubmatch(line); match != nil {
+				version.Extensions[match[1]] = match[2]
+			}
+		}
+	}
+
+	return version
+}
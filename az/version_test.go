@@ -0,0 +1,86 @@
+package az_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	var (
+		cli    *fakes.CLI
+		logger *fakes.Logger
+		azure  *az.Az
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		logger = &fakes.Logger{}
+		azure = az.NewAz(cli, logger)
+	})
+
+	It("reads the versions from az version", func() {
+		cli.ExecuteCall.Returns.Output = `{
+			"azure-cli": "2.53.0",
+			"azure-cli-core": "2.53.0",
+			"azure-cli-telemetry": "1.1.0",
+			"extensions": {"azure-devops": "0.26.0"}
+		}`
+
+		version, err := azure.Version(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cli.ExecuteCall.Receives.AllArgs).To(Equal([][]string{{"version", "--output", "json"}}))
+		Expect(version).To(Equal(az.CLIVersion{Core: "2.53.0", Extensions: map[string]string{"azure-devops": "0.26.0"}}))
+	})
+
+	Context("when the azure-cli has no version command", func() {
+		It("reads the versions from az -v", func() {
+			cli.ExecuteCall.Stub = func(args []string) (string, error) {
+				if args[0] == "version" {
+					return "ERROR: 'version' is misspelled or not recognized by the system.", errors.New("exit status 2")
+				}
+				return `azure-cli                         2.0.80 *
+
+command-modules-nspkg              2.0.3
+core                              2.0.80 *
+telemetry                          1.0.4
+
+Extensions:
+azure-devops                      0.17.0
+
+Python location '/usr/bin/python3'
+Python (Linux) 3.6.5 (default, Apr  1 2018, 05:46:30)
+`, nil
+			}
+
+			version, err := azure.Version(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"-v"}))
+			Expect(version).To(Equal(az.CLIVersion{Core: "2.0.80", Extensions: map[string]string{"azure-devops": "0.17.0"}}))
+		})
+	})
+
+	Describe("Dialect", func() {
+		It("speaks Microsoft Graph from 2.37.0", func() {
+			Expect(az.CLIVersion{Core: "2.36.0"}.Dialect()).To(Equal(az.AzureADGraph))
+			Expect(az.CLIVersion{Core: "2.37.0"}.Dialect()).To(Equal(az.MicrosoftGraph))
+		})
+	})
+
+	Describe("Supports", func() {
+		It("names the feature that needs a newer azure-cli", func() {
+			Expect(az.CLIVersion{Core: "2.37.0"}.Supports(az.FeatureFederatedCredentials)).To(Succeed())
+			Expect(az.CLIVersion{Core: "2.53.0"}.Supports(az.FeatureFederatedCredentials)).To(Succeed())
+
+			err := az.CLIVersion{Core: "2.30.0"}.Supports(az.FeatureFederatedCredentials)
+			Expect(err).To(MatchError("Creating federated credentials needs azure-cli 2.37.0 or later, but 2.30.0 is installed. Please update the azure-cli."))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+type Result struct {
+	Principal Principal
+	ClientId  string
+	Error     error
+}
+
+// Run provisions the principals with at most workers of them in flight at a
+// time. A principal that fails does not stop the others; its error is kept
+// in its result. Once the context is done the principals that have not
+// started fail with its error. The results are in the order of the principals.
+func Run(ctx context.Context, principals []Principal, workers int, provision func(context.Context, Principal) (string, error)) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]Result, len(principals))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					results[i] = Result{Principal: principals[i], Error: ctx.Err()}
+					continue
+				}
+
+				clientId, err := provision(ctx, principals[i])
+				results[i] = Result{
+					Principal: principals[i],
+					ClientId:  clientId,
+					Error:     err,
+				}
+			}
+		}()
+	}
+
+	for i := range principals {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Failed counts the results with an error.
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Summary renders a table of the results followed by the counts of created
+// and failed principals.
+func Summary(results []Result) string {
+	buffer := bytes.NewBuffer([]byte{})
+
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "DISPLAY NAME\tSTATUS\tCLIENT ID\tERROR")
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Fprintf(writer, "%s\tfailed\t%s\t%s\n", result.Principal.DisplayName, result.ClientId, strings.SplitN(result.Error.Error(), "\n", 2)[0])
+		} else {
+			fmt.Fprintf(writer, "%s\tcreated\t%s\t\n", result.Principal.DisplayName, result.ClientId)
+		}
+	}
+	writer.Flush()
+
+	failed := Failed(results)
+	fmt.Fprintf(buffer, "\nCreated %d of %d principals, %d failed.\n", len(results)-failed, len(results), failed)
+
+	return buffer.String()
+}
@@ -0,0 +1,103 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/genevieve/az-automation/batch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batch", func() {
+	var principals []batch.Principal
+
+	BeforeEach(func() {
+		principals = []batch.Principal{}
+		for i := 0; i < 6; i++ {
+			principals = append(principals, batch.Principal{DisplayName: fmt.Sprintf("team-%d", i)})
+		}
+	})
+
+	Describe("Run", func() {
+		It("provisions every principal with at most the given number of workers", func() {
+			var (
+				mutex    sync.Mutex
+				inFlight int
+				maximum  int
+			)
+
+			results := batch.Run(context.Background(), principals, 2, func(ctx context.Context, principal batch.Principal) (string, error) {
+				mutex.Lock()
+				inFlight++
+				if inFlight > maximum {
+					maximum = inFlight
+				}
+				mutex.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mutex.Lock()
+				inFlight--
+				mutex.Unlock()
+
+				return principal.DisplayName + "-id", nil
+			})
+
+			Expect(maximum).To(Equal(2))
+			Expect(results).To(HaveLen(6))
+			for i, result := range results {
+				Expect(result.Principal).To(Equal(principals[i]))
+				Expect(result.ClientId).To(Equal(fmt.Sprintf("team-%d-id", i)))
+				Expect(result.Error).NotTo(HaveOccurred())
+			}
+		})
+
+		It("keeps provisioning when a principal fails", func() {
+			results := batch.Run(context.Background(), principals, 3, func(ctx context.Context, principal batch.Principal) (string, error) {
+				if principal.DisplayName == "team-1" {
+					return "", errors.New("failed to create application")
+				}
+				return principal.DisplayName + "-id", nil
+			})
+
+			Expect(results[1].Error).To(MatchError("failed to create application"))
+			Expect(batch.Failed(results)).To(Equal(1))
+		})
+
+		It("fails the principals that have not started once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			results := batch.Run(ctx, principals, 1, func(ctx context.Context, principal batch.Principal) (string, error) {
+				if principal.DisplayName == "team-1" {
+					cancel()
+				}
+				return principal.DisplayName + "-id", nil
+			})
+
+			Expect(results[1].ClientId).To(Equal("team-1-id"))
+			Expect(results[2].Error).To(Equal(context.Canceled))
+			Expect(batch.Failed(results)).To(Equal(4))
+		})
+	})
+
+	Describe("Summary", func() {
+		It("renders a table of the results and the counts", func() {
+			summary := batch.Summary([]batch.Result{
+				{Principal: batch.Principal{DisplayName: "team-a"}, ClientId: "1234"},
+				{Principal: batch.Principal{DisplayName: "team-b"}, ClientId: "5678", Error: errors.New("Running [role assignment create]: forbidden\nmore detail")},
+			})
+
+			Expect(summary).To(Equal(`DISPLAY NAME  STATUS   CLIENT ID  ERROR
+team-a        created  1234       
+team-b        failed   5678       Running [role assignment create]: forbidden
+
+Created 1 of 2 principals, 1 failed.
+`))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+var columns = []string{"display_name", "identifier_uri", "credential_output_file", "roles", "scope"}
+
+type Principal struct {
+	DisplayName          string   `json:"display_name"`
+	IdentifierUri        string   `json:"identifier_uri"`
+	CredentialOutputFile string   `json:"credential_output_file"`
+	Roles                []string `json:"roles"`
+	Scope                string   `json:"scope"`
+}
+
+// Parse reads the principals of a batch from the contents of the file at
+// path: a JSON file, an array of objects, or otherwise a CSV file with a
+// header row naming the columns. Roles in a CSV file are separated by
+// semicolons.
+func Parse(path string, contents []byte) ([]Principal, error) {
+	reader := bytes.NewReader(contents)
+
+	var (
+		principals []Principal
+		err        error
+	)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		principals, err = parseJSON(reader)
+	} else {
+		principals, err = parseCSV(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return principals, validate(principals)
+}
+
+func parseJSON(reader io.Reader) ([]Principal, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	principals := []Principal{}
+	err := decoder.Decode(&principals)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unmarshalling batch json: %s", err))
+	}
+
+	return principals, nil
+}
+
+func parseCSV(reader io.Reader) ([]Principal, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Reading batch csv: %s", err))
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("The batch file is empty.")
+	}
+
+	index := map[string]int{}
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !contains(columns, column) {
+			return nil, errors.New(fmt.Sprintf("The batch column %s is not one of %s.", column, strings.Join(columns, ", ")))
+		}
+		index[column] = i
+	}
+
+	value := func(record []string, column string) string {
+		if i, ok := index[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	principals := []Principal{}
+	for _, record := range records[1:] {
+		principal := Principal{
+			DisplayName:          value(record, "display_name"),
+			IdentifierUri:        value(record, "identifier_uri"),
+			CredentialOutputFile: value(record, "credential_output_file"),
+			Scope:                value(record, "scope"),
+		}
+
+		for _, role := range strings.Split(value(record, "roles"), ";") {
+			if role = strings.TrimSpace(role); role != "" {
+				principal.Roles = append(principal.Roles, role)
+			}
+		}
+
+		principals = append(principals, principal)
+	}
+
+	return principals, nil
+}
+
+// validate rejects principals that would collide with each other, since the
+// display names are only checked against existing applications.
+func validate(principals []Principal) error {
+	if len(principals) == 0 {
+		return errors.New("The batch file has no principals.")
+	}
+
+	displayNames := map[string]bool{}
+	files := map[string]bool{}
+	for i, principal := range principals {
+		if principal.DisplayName == "" {
+			return errors.New(fmt.Sprintf("Principal %d of the batch file has no display_name.", i+1))
+		}
+
+		displayName := strings.ToLower(principal.DisplayName)
+		if displayNames[displayName] {
+			return errors.New(fmt.Sprintf("The display_name %s appears more than once in the batch file.", principal.DisplayName))
+		}
+		displayNames[displayName] = true
+
+		if principal.CredentialOutputFile == "" {
+			continue
+		}
+
+		file := filepath.Clean(principal.CredentialOutputFile)
+		if files[file] {
+			return errors.New(fmt.Sprintf("The credential_output_file %s appears more than once in the batch file.", principal.CredentialOutputFile))
+		}
+		files[file] = true
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package batch_test
+
+import (
+	"github.com/genevieve/az-automation/batch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	It("reads the principals of a csv file", func() {
+		principals, err := batch.Parse("principals.csv", []byte(`display_name,credential_output_file,roles,scope
+team-a,team-a.tfvars,Reader; Contributor,/subscriptions/1234/resourceGroups/a
+team-b,team-b.tfvars,,
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(principals).To(Equal([]batch.Principal{
+			{
+				DisplayName:          "team-a",
+				CredentialOutputFile: "team-a.tfvars",
+				Roles:                []string{"Reader", "Contributor"},
+				Scope:                "/subscriptions/1234/resourceGroups/a",
+			},
+			{
+				DisplayName:          "team-b",
+				CredentialOutputFile: "team-b.tfvars",
+			},
+		}))
+	})
+
+	It("reads the principals of a json file", func() {
+		principals, err := batch.Parse("principals.json", []byte(`[
+			{"display_name": "team-a", "identifier_uri": "https://contoso.com/team-a", "credential_output_file": "team-a.tfvars", "roles": ["Reader"]}
+		]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(principals).To(Equal([]batch.Principal{{
+			DisplayName:          "team-a",
+			IdentifierUri:        "https://contoso.com/team-a",
+			CredentialOutputFile: "team-a.tfvars",
+			Roles:                []string{"Reader"},
+		}}))
+	})
+
+	Context("when a csv column is unknown", func() {
+		It("returns a helpful error", func() {
+			_, err := batch.Parse("principals.csv", []byte("display_name,banana\nteam-a,yellow\n"))
+			Expect(err).To(MatchError("The batch column banana is not one of display_name, identifier_uri, credential_output_file, roles, scope."))
+		})
+	})
+
+	Context("when a principal has no display name", func() {
+		It("returns a helpful error", func() {
+			_, err := batch.Parse("principals.csv", []byte("display_name,credential_output_file\nteam-a,a.tfvars\n,b.tfvars\n"))
+			Expect(err).To(MatchError("Principal 2 of the batch file has no display_name."))
+		})
+	})
+
+	Context("when a display name appears twice", func() {
+		It("returns a helpful error", func() {
+			_, err := batch.Parse("principals.csv", []byte("display_name,credential_output_file\nteam-a,a.tfvars\nTeam-A,b.tfvars\n"))
+			Expect(err).To(MatchError("The display_name Team-A appears more than once in the batch file."))
+		})
+	})
+
+	Context("when a credential output file appears twice", func() {
+		It("returns a helpful error", func() {
+			_, err := batch.Parse("principals.csv", []byte("display_name,credential_output_file\nteam-a,creds.tfvars\nteam-b,./creds.tfvars\n"))
+			Expect(err).To(MatchError("The credential_output_file ./creds.tfvars appears more than once in the batch file."))
+		})
+	})
+
+	Context("when the file has no principals", func() {
+		It("returns a helpful error", func() {
+			_, err := batch.Parse("principals.json", []byte("[]"))
+			Expect(err).To(MatchError("The batch file has no principals."))
+		})
+	})
+
+})
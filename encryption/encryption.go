@@ -0,0 +1,222 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"github.com/genevieve/az-automation/az"
+	"golang.org/x/crypto/ssh"
+)
+
+type format interface {
+	Render(credentials az.Credentials) ([]byte, error)
+}
+
+// Format encrypts the output of another format to a set of recipients as an
+// armored age file, so that it can be committed or shared as text.
+type Format struct {
+	format     format
+	recipients []age.Recipient
+}
+
+func NewFormat(format format, recipients []age.Recipient) Format {
+	return Format{
+		format:     format,
+		recipients: recipients,
+	}
+}
+
+func (f Format) Render(credentials az.Credentials) ([]byte, error) {
+	plaintext, err := f.format.Render(credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encrypt(plaintext, f.recipients)
+}
+
+func Encrypt(plaintext []byte, recipients []age.Recipient) ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	armorWriter := armor.NewWriter(buffer)
+
+	writer, err := age.Encrypt(armorWriter, recipients...)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Encrypting credentials: %s", err))
+	}
+
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Encrypting credentials: %s", err))
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Encrypting credentials: %s", err))
+	}
+
+	err = armorWriter.Close()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Encrypting credentials: %s", err))
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func Decrypt(ciphertext []byte, identities []age.Identity) ([]byte, error) {
+	var reader io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(armor.Header)) {
+		reader = armor.NewReader(reader)
+	}
+
+	plaintext, err := age.Decrypt(reader, identities...)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Decrypting credentials: %s", err))
+	}
+
+	output, err := ioutil.ReadAll(plaintext)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Decrypting credentials: %s", err))
+	}
+
+	return output, nil
+}
+
+// ParseRecipients accepts age X25519 recipients and ssh-ed25519 or ssh-rsa
+// public keys, either directly or one per line in recipient files.
+func ParseRecipients(keys []string, files []string) ([]age.Recipient, error) {
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Reading recipients file: %s", err))
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(contents))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			keys = append(keys, line)
+		}
+	}
+
+	recipients := []age.Recipient{}
+	for _, key := range keys {
+		recipient, err := parseRecipient(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, errors.New("Please provide at least one recipient to encrypt the credentials to.")
+	}
+
+	return recipients, nil
+}
+
+func parseRecipient(key string) (age.Recipient, error) {
+	switch {
+	case strings.HasPrefix(key, "age1"):
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Parsing age recipient %s: %s", key, err))
+		}
+		return recipient, nil
+	case strings.HasPrefix(key, "ssh-"):
+		recipient, err := agessh.ParseRecipient(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Parsing ssh recipient %s: %s", key, err))
+		}
+		return recipient, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("The recipient %s is not an age or ssh public key.", key))
+	}
+}
+
+// ParseIdentities reads an age identity file or an unencrypted ssh private key.
+func ParseIdentities(file string) ([]age.Identity, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Reading identity file: %s", err))
+	}
+
+	if bytes.Contains(contents, []byte("PRIVATE KEY-----")) {
+		identity, err := parseSSHIdentity(contents)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Parsing ssh identity %s: %s", file, err))
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(contents))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Parsing age identities %s: %s", file, err))
+	}
+
+	return identities, nil
+}
+
+func parseSSHIdentity(pemBytes []byte) (age.Identity, error) {
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, errors.New("passphrase protected keys are not supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return agessh.NewRSAIdentity(k)
+	case ed25519.PrivateKey:
+		return agessh.NewEd25519Identity(k)
+	case *ed25519.PrivateKey:
+		return agessh.NewEd25519Identity(*k)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported key type %T", key))
+	}
+}
+
+// DecryptFile decrypts the input file with the identities and writes the
+// plaintext to the output file, or to stdout when no output file is given.
+func DecryptFile(input, output, identityFile string, stdout io.Writer) error {
+	identities, err := ParseIdentities(identityFile)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := ioutil.ReadFile(input)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Reading encrypted file: %s", err))
+	}
+
+	plaintext, err := Decrypt(ciphertext, identities)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = stdout.Write(plaintext)
+		return err
+	}
+
+	err = ioutil.WriteFile(output, plaintext, os.FileMode(0600))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing decrypted file: %s", err))
+	}
+
+	return nil
+}
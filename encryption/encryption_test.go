@@ -0,0 +1,203 @@
+package encryption_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/encryption"
+	"golang.org/x/crypto/ssh"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryption", func() {
+	var (
+		dir         string
+		credentials az.Credentials
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "encryption")
+		Expect(err).NotTo(HaveOccurred())
+
+		credentials = az.Credentials{
+			SubscriptionId: "subscription-id",
+			TenantId:       "tenant-id",
+			ClientId:       "client-id",
+			ClientSecret:   "client-secret",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Format", func() {
+		It("encrypts the rendered credentials to an age recipient", func() {
+			identity, err := age.GenerateX25519Identity()
+			Expect(err).NotTo(HaveOccurred())
+
+			recipients, err := encryption.ParseRecipients([]string{identity.Recipient().String()}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			ciphertext, err := encryption.NewFormat(az.Tfvars{}, recipients).Render(credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(ciphertext)).To(HavePrefix("-----BEGIN AGE ENCRYPTED FILE-----"))
+			Expect(string(ciphertext)).NotTo(ContainSubstring("client-secret"))
+
+			plaintext, err := encryption.Decrypt(ciphertext, []age.Identity{identity})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(ContainSubstring("client_secret = \"client-secret\""))
+		})
+	})
+
+	Describe("ParseRecipients", func() {
+		It("reads recipients from files, skipping comments and blank lines", func() {
+			first, err := age.GenerateX25519Identity()
+			Expect(err).NotTo(HaveOccurred())
+			second, err := age.GenerateX25519Identity()
+			Expect(err).NotTo(HaveOccurred())
+
+			file := filepath.Join(dir, "recipients.txt")
+			err = ioutil.WriteFile(file, []byte("# the team\n"+first.Recipient().String()+"\n\n"+second.Recipient().String()+"\n"), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			recipients, err := encryption.ParseRecipients(nil, []string{file})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recipients).To(HaveLen(2))
+
+			ciphertext, err := encryption.Encrypt([]byte("banana"), recipients)
+			Expect(err).NotTo(HaveOccurred())
+
+			plaintext, err := encryption.Decrypt(ciphertext, []age.Identity{second})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("banana"))
+		})
+
+		Context("when no recipients are provided", func() {
+			It("returns a helpful error", func() {
+				_, err := encryption.ParseRecipients(nil, nil)
+				Expect(err).To(MatchError("Please provide at least one recipient to encrypt the credentials to."))
+			})
+		})
+
+		Context("when a recipient is not a public key", func() {
+			It("returns a helpful error", func() {
+				_, err := encryption.ParseRecipients([]string{"banana"}, nil)
+				Expect(err).To(MatchError("The recipient banana is not an age or ssh public key."))
+			})
+		})
+	})
+
+	Describe("DecryptFile", func() {
+		var encrypted string
+
+		encryptTo := func(publicKey ssh.PublicKey) {
+			recipients, err := encryption.ParseRecipients([]string{string(ssh.MarshalAuthorizedKey(publicKey))}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			ciphertext, err := encryption.Encrypt([]byte("banana"), recipients)
+			Expect(err).NotTo(HaveOccurred())
+
+			encrypted = filepath.Join(dir, "creds.tfvars.age")
+			err = ioutil.WriteFile(encrypted, ciphertext, 0600)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		writeKey := func(block *pem.Block) string {
+			file := filepath.Join(dir, "id")
+			err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600)
+			Expect(err).NotTo(HaveOccurred())
+			return file
+		}
+
+		Context("with an ssh ed25519 key", func() {
+			var identityFile string
+
+			BeforeEach(func() {
+				public, private, err := ed25519.GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				publicKey, err := ssh.NewPublicKey(public)
+				Expect(err).NotTo(HaveOccurred())
+				encryptTo(publicKey)
+
+				der, err := x509.MarshalPKCS8PrivateKey(private)
+				Expect(err).NotTo(HaveOccurred())
+				identityFile = writeKey(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+			})
+
+			It("writes the plaintext to stdout", func() {
+				stdout := bytes.NewBuffer([]byte{})
+
+				err := encryption.DecryptFile(encrypted, "", identityFile, stdout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stdout.String()).To(Equal("banana"))
+			})
+
+			It("writes the plaintext to the output file", func() {
+				output := filepath.Join(dir, "creds.tfvars")
+
+				err := encryption.DecryptFile(encrypted, output, identityFile, nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(output)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("banana"))
+			})
+		})
+
+		Context("with an ssh rsa key", func() {
+			var identityFile string
+
+			BeforeEach(func() {
+				private, err := rsa.GenerateKey(rand.Reader, 2048)
+				Expect(err).NotTo(HaveOccurred())
+
+				publicKey, err := ssh.NewPublicKey(&private.PublicKey)
+				Expect(err).NotTo(HaveOccurred())
+				encryptTo(publicKey)
+
+				identityFile = writeKey(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+			})
+
+			It("decrypts the file", func() {
+				stdout := bytes.NewBuffer([]byte{})
+
+				err := encryption.DecryptFile(encrypted, "", identityFile, stdout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stdout.String()).To(Equal("banana"))
+			})
+		})
+
+		Context("when the identity is not a recipient", func() {
+			It("returns a helpful error", func() {
+				public, _, err := ed25519.GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				publicKey, err := ssh.NewPublicKey(public)
+				Expect(err).NotTo(HaveOccurred())
+				encryptTo(publicKey)
+
+				identity, err := age.GenerateX25519Identity()
+				Expect(err).NotTo(HaveOccurred())
+				identityFile := filepath.Join(dir, "key.txt")
+				err = ioutil.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = encryption.DecryptFile(encrypted, "", identityFile, nil)
+				Expect(err).To(MatchError(ContainSubstring("Decrypting credentials: ")))
+			})
+		})
+	})
+})
@@ -0,0 +1,138 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	StepStarted             = "started"
+	StepApplication         = "application"
+	StepIdentifierUri       = "identifier-uri"
+	StepFederatedCredential = "federated-credential"
+	StepServicePrincipal    = "service-principal"
+	StepRoleAssignment      = "role-assignment"
+	StepSecret              = "secret"
+	StepCredentials         = "credentials"
+	StepDeleted             = "deleted"
+	StepCompleted           = "completed"
+
+	// The steps of rotating the client secret of a principal.
+	StepRotationStarted     = "rotation-started"
+	StepRotationSecret      = "rotation-secret"
+	StepRotationCredentials = "rotation-credentials"
+	StepRotationCompleted   = "rotation-completed"
+)
+
+// Entry is the outcome of one step for one principal. The client secret is
+// never recorded, only the sinks it was written to.
+type Entry struct {
+	Time             time.Time       `json:"time"`
+	Principal        string          `json:"principal"`
+	Step             string          `json:"step"`
+	Run              json.RawMessage `json:"run,omitempty"`
+	DisplayName      string          `json:"display_name,omitempty"`
+	IdentifierUri    string          `json:"identifier_uri,omitempty"`
+	ClientId         string          `json:"client_id,omitempty"`
+	ObjectId         string          `json:"object_id,omitempty"`
+	Role             string          `json:"role,omitempty"`
+	Scope            string          `json:"scope,omitempty"`
+	RoleAssignmentId string          `json:"role_assignment_id,omitempty"`
+	KeyId            string          `json:"key_id,omitempty"`
+	KeyIds           []string        `json:"key_ids,omitempty"`
+	Sinks            []string        `json:"sinks,omitempty"`
+	ExpiresOn        *time.Time      `json:"expires_on,omitempty"`
+}
+
+type Journal struct {
+	file  *os.File
+	mutex *sync.Mutex
+}
+
+// Open opens the journal at path for appending, creating it if it does not
+// exist yet.
+func Open(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Opening journal: %s", err))
+	}
+
+	return &Journal{
+		file:  file,
+		mutex: &sync.Mutex{},
+	}, nil
+}
+
+// Record appends the entry as a line of json and syncs it to disk before
+// returning, so a step is never taken twice after a crash.
+func (j *Journal) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling journal entry json: %s", err))
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, err = j.file.Write(append(line, '\n'))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing journal: %s", err))
+	}
+
+	err = j.file.Sync()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Syncing journal: %s", err))
+	}
+
+	return nil
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Read returns the entries of the journal at path in the order they were
+// recorded. A last line cut short by a crash is ignored.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Opening journal: %s", err))
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte{}, scanner.Bytes()...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Reading journal: %s", err))
+	}
+
+	entries := []Entry{}
+	for i, line := range lines {
+		entry := Entry{}
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, errors.New(fmt.Sprintf("Unmarshalling journal entry json on line %d: %s", i+1, err))
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,94 @@
+package journal_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/genevieve/az-automation/journal"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "journal")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "az-automation.journal")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("appends entries that can be read back", func() {
+		expiresOn := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		j, err := journal.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Record(journal.Entry{Principal: "team-a", Step: journal.StepStarted, Run: json.RawMessage(`{"account":"1234"}`)})).To(Succeed())
+		Expect(j.Record(journal.Entry{Principal: "team-a", Step: journal.StepApplication, ClientId: "the-client-id", ExpiresOn: &expiresOn})).To(Succeed())
+		Expect(j.Close()).To(Succeed())
+
+		j, err = journal.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Record(journal.Entry{Principal: "team-a", Step: journal.StepCompleted})).To(Succeed())
+		Expect(j.Close()).To(Succeed())
+
+		entries, err := journal.Read(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[0].Step).To(Equal(journal.StepStarted))
+		Expect(string(entries[0].Run)).To(Equal(`{"account":"1234"}`))
+		Expect(entries[1].ClientId).To(Equal("the-client-id"))
+		Expect(*entries[1].ExpiresOn).To(Equal(expiresOn))
+		Expect(entries[2].Step).To(Equal(journal.StepCompleted))
+		Expect(entries[2].Time).NotTo(BeZero())
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	Context("when the last line was cut short", func() {
+		It("ignores it", func() {
+			err := ioutil.WriteFile(path, []byte(`{"principal":"team-a","step":"started"}
+{"principal":"team-a","step":"appl`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			entries, err := journal.Read(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+	})
+
+	Context("when an earlier line is invalid", func() {
+		It("returns a helpful error", func() {
+			err := ioutil.WriteFile(path, []byte(`banana
+{"principal":"team-a","step":"started"}
+`), 0600)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = journal.Read(path)
+			Expect(err).To(MatchError(ContainSubstring("Unmarshalling journal entry json on line 1: ")))
+		})
+	})
+
+	Context("when the journal does not exist", func() {
+		It("returns a helpful error", func() {
+			_, err := journal.Read(path)
+			Expect(err).To(MatchError(ContainSubstring("Opening journal: ")))
+		})
+	})
+})
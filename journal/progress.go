@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Progress is what the journal knows of one principal's latest run.
+type Progress struct {
+	Principal           string
+	Run                 json.RawMessage
+	DisplayName         string
+	IdentifierUri       string
+	ClientId            string
+	ExpiresOn           time.Time
+	IdentifierUriSet    bool
+	FederatedCredential bool
+	ServicePrincipalId  string
+	assignments         map[roleScope]string
+	CredentialsWritten  bool
+	Completed           bool
+	Rotation            *Rotation
+}
+
+// Rotation is the progress of replacing the client secret of a principal
+// that has not finished yet. The ObsoleteKeyIds are the client secrets to
+// delete once the new one, KeyId, has been written everywhere.
+type Rotation struct {
+	ClientId           string
+	ObsoleteKeyIds     []string
+	KeyId              string
+	ExpiresOn          time.Time
+	CredentialsWritten bool
+}
+
+type roleScope struct {
+	role  string
+	scope string
+}
+
+// Assigned reports whether the role has been assigned at the scope.
+func (p Progress) Assigned(role, scope string) bool {
+	_, ok := p.assignments[roleScope{role, scope}]
+	return ok
+}
+
+// AssignmentId returns the id of the assignment of the role at the scope.
+func (p Progress) AssignmentId(role, scope string) string {
+	return p.assignments[roleScope{role, scope}]
+}
+
+// Replay folds the entries into the progress of each principal, in the order
+// the principals were started. A principal started again begins anew, as
+// does one whose application was deleted.
+func Replay(entries []Entry) []Progress {
+	index := map[string]int{}
+	progresses := []Progress{}
+
+	for _, entry := range entries {
+		i, ok := index[entry.Principal]
+		if !ok {
+			i = len(progresses)
+			index[entry.Principal] = i
+			progresses = append(progresses, Progress{Principal: entry.Principal})
+		}
+		p := &progresses[i]
+
+		switch entry.Step {
+		case StepStarted:
+			*p = Progress{Principal: entry.Principal, Run: entry.Run}
+		case StepApplication:
+			p.DisplayName = entry.DisplayName
+			p.IdentifierUri = entry.IdentifierUri
+			p.ClientId = entry.ClientId
+			if entry.ExpiresOn != nil {
+				p.ExpiresOn = *entry.ExpiresOn
+			}
+		case StepIdentifierUri:
+			p.IdentifierUriSet = true
+		case StepFederatedCredential:
+			p.FederatedCredential = true
+		case StepServicePrincipal:
+			p.ServicePrincipalId = entry.ObjectId
+		case StepRoleAssignment:
+			if p.assignments == nil {
+				p.assignments = map[roleScope]string{}
+			}
+			p.assignments[roleScope{entry.Role, entry.Scope}] = entry.RoleAssignmentId
+		case StepSecret:
+			if entry.ExpiresOn != nil {
+				p.ExpiresOn = *entry.ExpiresOn
+			}
+		case StepCredentials:
+			p.CredentialsWritten = true
+		case StepDeleted:
+			*p = Progress{Principal: entry.Principal, Run: p.Run}
+		case StepCompleted:
+			p.Completed = true
+		case StepRotationStarted:
+			p.Rotation = &Rotation{ClientId: entry.ClientId, ObsoleteKeyIds: entry.KeyIds}
+		case StepRotationSecret:
+			if p.Rotation != nil {
+				p.Rotation.KeyId = entry.KeyId
+				if entry.ExpiresOn != nil {
+					p.Rotation.ExpiresOn = *entry.ExpiresOn
+				}
+			}
+		case StepRotationCredentials:
+			if p.Rotation != nil {
+				p.Rotation.CredentialsWritten = true
+			}
+		case StepRotationCompleted:
+			p.Rotation = nil
+		}
+	}
+
+	return progresses
+}
@@ -0,0 +1,114 @@
+package journal_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/genevieve/az-automation/journal"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replay", func() {
+	var expiresOn time.Time
+
+	BeforeEach(func() {
+		expiresOn = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	})
+
+	It("folds the entries into the progress of each principal", func() {
+		progresses := journal.Replay([]journal.Entry{
+			{Principal: "team-a", Step: journal.StepStarted, Run: json.RawMessage(`{}`)},
+			{Principal: "team-b", Step: journal.StepStarted, Run: json.RawMessage(`{}`)},
+			{Principal: "team-a", Step: journal.StepApplication, DisplayName: "team-a", ClientId: "a-id", ExpiresOn: &expiresOn},
+			{Principal: "team-a", Step: journal.StepIdentifierUri},
+			{Principal: "team-a", Step: journal.StepServicePrincipal, ObjectId: "a-object-id"},
+			{Principal: "team-a", Step: journal.StepRoleAssignment, Role: "Reader", Scope: "/subscriptions/1234", RoleAssignmentId: "assignment-id"},
+			{Principal: "team-b", Step: journal.StepApplication, DisplayName: "team-b", ClientId: "b-id"},
+			{Principal: "team-b", Step: journal.StepCredentials},
+			{Principal: "team-b", Step: journal.StepCompleted},
+		})
+
+		Expect(progresses).To(HaveLen(2))
+
+		a := progresses[0]
+		Expect(a.Principal).To(Equal("team-a"))
+		Expect(a.ClientId).To(Equal("a-id"))
+		Expect(a.ExpiresOn).To(Equal(expiresOn))
+		Expect(a.IdentifierUriSet).To(BeTrue())
+		Expect(a.ServicePrincipalId).To(Equal("a-object-id"))
+		Expect(a.Assigned("Reader", "/subscriptions/1234")).To(BeTrue())
+		Expect(a.Assigned("Contributor", "/subscriptions/1234")).To(BeFalse())
+		Expect(a.AssignmentId("Reader", "/subscriptions/1234")).To(Equal("assignment-id"))
+		Expect(a.CredentialsWritten).To(BeFalse())
+		Expect(a.Completed).To(BeFalse())
+
+		b := progresses[1]
+		Expect(b.CredentialsWritten).To(BeTrue())
+		Expect(b.Completed).To(BeTrue())
+	})
+
+	It("starts over when a principal is started again", func() {
+		progresses := journal.Replay([]journal.Entry{
+			{Principal: "team-a", Step: journal.StepStarted, Run: json.RawMessage(`{"first":true}`)},
+			{Principal: "team-a", Step: journal.StepApplication, ClientId: "a-id"},
+			{Principal: "team-a", Step: journal.StepCompleted},
+			{Principal: "team-a", Step: journal.StepStarted, Run: json.RawMessage(`{"first":false}`)},
+		})
+
+		Expect(progresses).To(HaveLen(1))
+		Expect(progresses[0].ClientId).To(BeEmpty())
+		Expect(progresses[0].Completed).To(BeFalse())
+		Expect(string(progresses[0].Run)).To(Equal(`{"first":false}`))
+	})
+
+	It("forgets the application once it was deleted", func() {
+		progresses := journal.Replay([]journal.Entry{
+			{Principal: "team-a", Step: journal.StepStarted, Run: json.RawMessage(`{}`)},
+			{Principal: "team-a", Step: journal.StepApplication, ClientId: "a-id"},
+			{Principal: "team-a", Step: journal.StepServicePrincipal, ObjectId: "a-object-id"},
+			{Principal: "team-a", Step: journal.StepDeleted, ClientId: "a-id"},
+		})
+
+		Expect(progresses[0].ClientId).To(BeEmpty())
+		Expect(progresses[0].ServicePrincipalId).To(BeEmpty())
+		Expect(string(progresses[0].Run)).To(Equal(`{}`))
+	})
+
+	It("keeps the expiry of a replaced secret", func() {
+		later := expiresOn.AddDate(1, 0, 0)
+		progresses := journal.Replay([]journal.Entry{
+			{Principal: "team-a", Step: journal.StepStarted},
+			{Principal: "team-a", Step: journal.StepApplication, ClientId: "a-id", ExpiresOn: &expiresOn},
+			{Principal: "team-a", Step: journal.StepSecret, ExpiresOn: &later},
+		})
+
+		Expect(progresses[0].ExpiresOn).To(Equal(later))
+	})
+
+	It("follows the rotation of the client secret until it completes", func() {
+		entries := []journal.Entry{
+			{Principal: "team-a", Step: journal.StepStarted},
+			{Principal: "team-a", Step: journal.StepApplication, ClientId: "a-id"},
+			{Principal: "team-a", Step: journal.StepCompleted},
+			{Principal: "team-a", Step: journal.StepRotationStarted, ClientId: "a-id", KeyIds: []string{"old-key-id"}},
+			{Principal: "team-a", Step: journal.StepRotationSecret, KeyId: "new-key-id", ExpiresOn: &expiresOn},
+		}
+
+		progresses := journal.Replay(entries)
+		Expect(progresses[0].Completed).To(BeTrue())
+		Expect(progresses[0].Rotation).To(Equal(&journal.Rotation{
+			ClientId:       "a-id",
+			ObsoleteKeyIds: []string{"old-key-id"},
+			KeyId:          "new-key-id",
+			ExpiresOn:      expiresOn,
+		}))
+
+		entries = append(entries,
+			journal.Entry{Principal: "team-a", Step: journal.StepRotationCredentials},
+			journal.Entry{Principal: "team-a", Step: journal.StepRotationCompleted},
+		)
+		Expect(journal.Replay(entries)[0].Rotation).To(BeNil())
+	})
+})
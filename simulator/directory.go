@@ -0,0 +1,301 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (s *Simulator) findApplication(id string) *application {
+	for _, app := range s.applications {
+		if strings.EqualFold(app.AppId, id) || strings.EqualFold(app.ObjectId, id) {
+			return app
+		}
+		for _, uri := range app.IdentifierUris {
+			if uri == id {
+				return app
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) findServicePrincipal(id string) *servicePrincipal {
+	for _, sp := range s.servicePrincipals {
+		if strings.EqualFold(sp.AppId, id) || strings.EqualFold(sp.ObjectId, id) {
+			return sp
+		}
+		for _, name := range sp.ServicePrincipalNames {
+			if name == id {
+				return sp
+			}
+		}
+	}
+	return nil
+}
+
+func notFound(id string) (string, error) {
+	return failure(fmt.Sprintf("ERROR: Resource '%s' does not exist or one of its queried reference-property objects are not present.", id))
+}
+
+// appList matches display names by prefix, ignoring case, like Azure AD.
+func (s *Simulator) appList(flags flags) (string, error) {
+	applications := []*application{}
+	for _, app := range s.applications {
+		switch {
+		case flags.has("--display-name"):
+			if strings.HasPrefix(strings.ToLower(app.DisplayName), strings.ToLower(flags.get("--display-name"))) {
+				applications = append(applications, app)
+			}
+		case flags.has("--identifier-uri"):
+			for _, uri := range app.IdentifierUris {
+				if uri == flags.get("--identifier-uri") {
+					applications = append(applications, app)
+				}
+			}
+		default:
+			applications = append(applications, app)
+		}
+	}
+
+	objects := []json.RawMessage{}
+	for _, app := range applications {
+		object, err := s.object(app)
+		if err != nil {
+			return object, err
+		}
+		objects = append(objects, json.RawMessage(object))
+	}
+	return marshal(objects)
+}
+
+func (s *Simulator) identifierUriTaken(uri string) bool {
+	for _, app := range s.applications {
+		for _, taken := range app.IdentifierUris {
+			if strings.EqualFold(taken, uri) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Simulator) appCreate(flags flags) (string, error) {
+	displayName := flags.get("--display-name")
+	if displayName == "" {
+		return failure("ERROR: the following arguments are required: --display-name")
+	}
+
+	identifierUris := flags["--identifier-uris"]
+	for _, uri := range identifierUris {
+		if s.identifierUriTaken(uri) {
+			return failure("ERROR: Another object with the same value for property identifierUris already exists.")
+		}
+		if !strings.HasPrefix(uri, "api://") && !strings.Contains(uri, Domain) {
+			return failure(fmt.Sprintf("ERROR: Values of identifierUris property must use a verified domain of the organization or its subdomain: '%s'", uri))
+		}
+	}
+
+	app := &application{
+		AppId:                newId(),
+		ObjectId:             newId(),
+		DisplayName:          displayName,
+		Homepage:             flags.get("--homepage") + flags.get("--web-home-page-url"),
+		IdentifierUris:       append([]string{}, identifierUris...),
+		PasswordCredentials:  []passwordCredential{},
+		federatedCredentials: []string{},
+	}
+	if flags.has("--password") {
+		credential, errOutput, err := newPasswordCredential(flags.get("--end-date"))
+		if err != nil {
+			return errOutput, err
+		}
+		app.PasswordCredentials = append(app.PasswordCredentials, credential)
+	}
+
+	s.applications = append(s.applications, app)
+	return s.object(app)
+}
+
+func newPasswordCredential(endDate string) (passwordCredential, string, error) {
+	start := time.Now().UTC()
+	end := start.AddDate(1, 0, 0)
+	if endDate != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, endDate)
+		if err != nil {
+			output, err := failure(fmt.Sprintf("ERROR: Unable to parse the --end-date %s.", endDate))
+			return passwordCredential{}, output, err
+		}
+	}
+
+	return passwordCredential{
+		KeyId:     newId(),
+		StartDate: start.Format(time.RFC3339),
+		EndDate:   end.UTC().Format(time.RFC3339),
+	}, "", nil
+}
+
+func (s *Simulator) appShow(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+	return s.object(app)
+}
+
+func (s *Simulator) appUpdate(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	if flags.has("--identifier-uris") {
+		for _, uri := range flags["--identifier-uris"] {
+			if s.identifierUriTaken(uri) && s.findApplication(uri) != app {
+				return failure("ERROR: Another object with the same value for property identifierUris already exists.")
+			}
+		}
+		app.IdentifierUris = append([]string{}, flags["--identifier-uris"]...)
+	}
+
+	return "", nil
+}
+
+// appDelete deletes the application along with its service principal. As in
+// Azure, the role assignments of the service principal are left behind for
+// an unknown principal, until they are deleted themselves.
+func (s *Simulator) appDelete(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	for i, candidate := range s.applications {
+		if candidate == app {
+			s.applications = append(s.applications[:i], s.applications[i+1:]...)
+			break
+		}
+	}
+
+	for i, sp := range s.servicePrincipals {
+		if sp.AppId == app.AppId {
+			s.servicePrincipals = append(s.servicePrincipals[:i], s.servicePrincipals[i+1:]...)
+
+			for j := range s.roleAssignments {
+				if s.roleAssignments[j].PrincipalId == sp.ObjectId {
+					s.roleAssignments[j].PrincipalName = ""
+					s.roleAssignments[j].PrincipalType = "Unknown"
+				}
+			}
+			break
+		}
+	}
+
+	return "", nil
+}
+
+// credentialReset replaces the client secrets of the application with the
+// password, or with a generated one. With --append the secret is added to
+// the ones the application has.
+func (s *Simulator) credentialReset(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	credential, errOutput, err := newPasswordCredential(flags.get("--end-date"))
+	if err != nil {
+		return errOutput, err
+	}
+	if flags.has("--append") {
+		app.PasswordCredentials = append(app.PasswordCredentials, credential)
+	} else {
+		app.PasswordCredentials = []passwordCredential{credential}
+	}
+
+	password := flags.get("--password")
+	if password == "" {
+		password = newId()
+	}
+
+	return marshal(map[string]string{
+		"appId":    app.AppId,
+		"password": password,
+		"tenant":   TenantId,
+	})
+}
+
+func (s *Simulator) credentialDelete(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	keyId := flags.get("--key-id")
+	for i, credential := range app.PasswordCredentials {
+		if credential.KeyId == keyId {
+			app.PasswordCredentials = append(app.PasswordCredentials[:i], app.PasswordCredentials[i+1:]...)
+			return "", nil
+		}
+	}
+
+	return failure(fmt.Sprintf("ERROR: No credential found with keyId %s.", keyId))
+}
+
+func (s *Simulator) federatedCredentialCreate(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	credential := map[string]interface{}{}
+	err := json.Unmarshal([]byte(flags.get("--parameters")), &credential)
+	if err != nil {
+		return failure(fmt.Sprintf("ERROR: Failed to parse --parameters: %s", err))
+	}
+
+	name, _ := credential["name"].(string)
+	for _, taken := range app.federatedCredentials {
+		if taken == name {
+			return failure("ERROR: FederatedIdentityCredential with name " + name + " already exists.")
+		}
+	}
+	app.federatedCredentials = append(app.federatedCredentials, name)
+
+	credential["id"] = newId()
+	return marshal(credential)
+}
+
+// spCreate creates the service principal of the application. Role assignments
+// cannot see it until the replication delay has passed.
+func (s *Simulator) spCreate(flags flags) (string, error) {
+	app := s.findApplication(flags.get("--id"))
+	if app == nil {
+		return notFound(flags.get("--id"))
+	}
+
+	if s.findServicePrincipal(app.AppId) != nil {
+		return failure("ERROR: Another object with the same value for property servicePrincipalNames already exists.")
+	}
+
+	sp := &servicePrincipal{
+		AppId:                 app.AppId,
+		ObjectId:              newId(),
+		DisplayName:           app.DisplayName,
+		ServicePrincipalNames: append([]string{app.AppId}, app.IdentifierUris...),
+		created:               time.Now(),
+	}
+	s.servicePrincipals = append(s.servicePrincipals, sp)
+
+	return s.object(sp)
+}
+
+func (s *Simulator) spShow(flags flags) (string, error) {
+	sp := s.findServicePrincipal(flags.get("--id"))
+	if sp == nil {
+		return notFound(flags.get("--id"))
+	}
+	return s.object(sp)
+}
@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (s *Simulator) roleAssignmentCreate(flags flags) (string, error) {
+	role := flags.get("--role")
+	known := false
+	for _, r := range Roles {
+		if strings.EqualFold(r, role) {
+			role = r
+			known = true
+		}
+	}
+	if !known {
+		return failure(fmt.Sprintf("ERROR: Role '%s' doesn't exist.", role))
+	}
+
+	assignee := flags.get("--assignee")
+	sp := s.findServicePrincipal(assignee)
+	if sp == nil {
+		return failure(fmt.Sprintf("ERROR: Cannot find user or service principal in graph database for '%s'. If the assignee is an appId, make sure the corresponding service principal is created with 'az ad sp create --id %s'.", assignee, assignee))
+	}
+	if time.Since(sp.created) < s.config.ReplicationDelay {
+		return failure(fmt.Sprintf("ERROR: Principal %s does not exist in the directory %s.", strings.Replace(sp.ObjectId, "-", "", -1), TenantId))
+	}
+
+	subscription := "/subscriptions/" + SubscriptionId
+	scope := flags.get("--scope")
+	if scope == "" {
+		scope = subscription
+	}
+	if !strings.HasPrefix(strings.ToLower(scope), subscription) {
+		return failure(fmt.Sprintf("ERROR: The client 'trainee@%s' does not have authorization to perform action 'Microsoft.Authorization/roleAssignments/write' over scope '%s' or the scope is invalid.", Domain, scope))
+	}
+
+	for _, assignment := range s.roleAssignments {
+		if assignment.PrincipalId == sp.ObjectId && assignment.RoleDefinitionName == role && strings.EqualFold(assignment.Scope, scope) {
+			return failure("ERROR: The role assignment already exists.")
+		}
+	}
+
+	assignment := roleAssignment{
+		Id:                 fmt.Sprintf("%s/providers/Microsoft.Authorization/roleAssignments/%s", strings.TrimSuffix(scope, "/"), newId()),
+		PrincipalId:        sp.ObjectId,
+		PrincipalType:      "ServicePrincipal",
+		RoleDefinitionName: role,
+		Scope:              scope,
+	}
+	s.roleAssignments = append(s.roleAssignments, assignment)
+
+	return marshal(assignment)
+}
+
+// roleAssignmentList lists the role assignments of the assignee, which may be
+// the signed-in user, at the scope or, with --all, at any scope.
+func (s *Simulator) roleAssignmentList(flags flags) (string, error) {
+	assignments := []roleAssignment{}
+
+	principalId := ""
+	if assignee := flags.get("--assignee"); assignee != "" {
+		if strings.EqualFold(assignee, User) || assignee == UserObjectId {
+			principalId = UserObjectId
+		} else {
+			sp := s.findServicePrincipal(assignee)
+			if sp == nil {
+				return failure(fmt.Sprintf("ERROR: Cannot find user or service principal in graph database for '%s'.", assignee))
+			}
+			principalId = sp.ObjectId
+		}
+	}
+
+	scope := strings.ToLower(strings.TrimSuffix(flags.get("--scope"), "/"))
+	if scope == "" && !flags.has("--all") {
+		scope = strings.ToLower("/subscriptions/" + SubscriptionId)
+	}
+
+	for _, assignment := range s.roleAssignments {
+		if principalId != "" && assignment.PrincipalId != principalId {
+			continue
+		}
+
+		assigned := strings.ToLower(assignment.Scope)
+		switch {
+		case flags.has("--all"), assigned == scope:
+		case flags.has("--include-inherited") && strings.HasPrefix(scope, assigned+"/"):
+		default:
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return marshal(assignments)
+}
+
+func (s *Simulator) roleAssignmentDelete(flags flags) (string, error) {
+	for _, id := range flags["--ids"] {
+		for i, assignment := range s.roleAssignments {
+			if strings.EqualFold(assignment.Id, id) {
+				s.roleAssignments = append(s.roleAssignments[:i], s.roleAssignments[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func (s *Simulator) keyVaultShow(flags flags) (string, error) {
+	name := flags.get("--name")
+	if !s.keyVaults[name] {
+		return failure(fmt.Sprintf("ERROR: The Vault '%s' not found within subscription.", name))
+	}
+	return marshal(map[string]string{"name": name})
+}
+
+func (s *Simulator) keyVaultCreate(flags flags) (string, error) {
+	name := flags.get("--name")
+	if flags.get("--resource-group") == "" {
+		return failure("ERROR: the following arguments are required: --resource-group/-g")
+	}
+
+	s.keyVaults[name] = true
+	return marshal(map[string]string{"name": name})
+}
@@ -0,0 +1,452 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	semver "github.com/hashicorp/go-version"
+)
+
+const (
+	SubscriptionId = "00000000-0000-0000-0000-000000000001"
+	TenantId       = "00000000-0000-0000-0000-0000000000aa"
+	Domain         = "simulated.onmicrosoft.com"
+
+	// Version is the azure-cli the simulator behaves like by default.
+	Version = "2.53.0"
+
+	// User is signed in to the simulator. It is an Application
+	// Administrator of the tenant and Owner of the subscription.
+	User         = "trainee@" + Domain
+	UserObjectId = "00000000-0000-0000-0000-0000000000bb"
+)
+
+// Roles are the role definitions known to the simulator.
+var Roles = []string{"Owner", "Contributor", "Reader", "User Access Administrator"}
+
+type Config struct {
+	// Version is the azure-cli to behave like, which decides whether the
+	// `az ad` commands speak Azure AD Graph or Microsoft Graph. Defaults to
+	// Version.
+	Version string
+
+	// ReplicationDelay is how long a new service principal takes to become
+	// visible to role assignments.
+	ReplicationDelay time.Duration
+
+	// CallsPerSecond throttles the commands beyond this rate, as Azure AD
+	// does. Zero or less does not throttle.
+	CallsPerSecond float64
+}
+
+type Simulator struct {
+	config Config
+	mutex  *sync.Mutex
+	calls  []time.Time
+
+	applications      []*application
+	servicePrincipals []*servicePrincipal
+	roleAssignments   []roleAssignment
+	keyVaults         map[string]bool
+	activeCloud       string
+}
+
+type application struct {
+	AppId               string               `json:"appId"`
+	ObjectId            string               `json:"objectId"`
+	DisplayName         string               `json:"displayName"`
+	Homepage            string               `json:"homepage"`
+	IdentifierUris      []string             `json:"identifierUris"`
+	PasswordCredentials []passwordCredential `json:"passwordCredentials"`
+
+	federatedCredentials []string
+}
+
+type passwordCredential struct {
+	KeyId     string `json:"keyId"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+}
+
+type servicePrincipal struct {
+	AppId                 string   `json:"appId"`
+	ObjectId              string   `json:"objectId"`
+	DisplayName           string   `json:"displayName"`
+	ServicePrincipalNames []string `json:"servicePrincipalNames"`
+
+	created time.Time
+}
+
+type roleAssignment struct {
+	Id                 string `json:"id"`
+	PrincipalId        string `json:"principalId"`
+	PrincipalName      string `json:"principalName"`
+	PrincipalType      string `json:"principalType"`
+	RoleDefinitionName string `json:"roleDefinitionName"`
+	Scope              string `json:"scope"`
+}
+
+// New returns an empty tenant with a single subscription, which answers the
+// azure-cli commands used by az-automation in place of the azure-cli.
+func New(config Config) *Simulator {
+	if config.Version == "" {
+		config.Version = Version
+	}
+	subscription := "/subscriptions/" + SubscriptionId
+
+	return &Simulator{
+		config:      config,
+		mutex:       &sync.Mutex{},
+		keyVaults:   map[string]bool{},
+		activeCloud: "AzureCloud",
+		roleAssignments: []roleAssignment{
+			{
+				Id:                 subscription + "/providers/Microsoft.Authorization/roleAssignments/" + newId(),
+				PrincipalId:        UserObjectId,
+				PrincipalName:      User,
+				PrincipalType:      "User",
+				RoleDefinitionName: "Owner",
+				Scope:              subscription,
+			},
+		},
+	}
+}
+
+// Execute answers the command like the azure-cli would, with the json it
+// prints on success or its error message on failure.
+func (s *Simulator) Execute(ctx context.Context, args []string) (string, error) {
+	if ctx.Err() != nil {
+		return "The azure-cli was interrupted.", ctx.Err()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.throttled() {
+		return failure("ERROR: Operation failed with status: 'Too Many Requests'. Details: 429 Client Error: Too Many Requests")
+	}
+
+	command, flags := parse(args)
+	if unrecognized := s.unrecognized(command, flags); len(unrecognized) > 0 {
+		return failure(fmt.Sprintf("ERROR: unrecognized arguments: %s", strings.Join(unrecognized, " ")))
+	}
+
+	if flags.has("--subscription") && !strings.EqualFold(flags.get("--subscription"), SubscriptionId) {
+		return failure(fmt.Sprintf("ERROR: Subscription '%s' not found. Check the spelling and casing and try again.", flags.get("--subscription")))
+	}
+
+	switch command {
+	case "":
+		if flags.has("-v") || flags.has("--version") {
+			return fmt.Sprintf("azure-cli                         %s\n\nPython (Linux) 3.6.5\n", s.config.Version), nil
+		}
+	case "version":
+		if s.atLeast("2.11.0") {
+			return marshal(map[string]interface{}{
+				"azure-cli":           s.config.Version,
+				"azure-cli-core":      s.config.Version,
+				"azure-cli-telemetry": "1.1.0",
+				"extensions":          map[string]string{},
+			})
+		}
+	case "account list":
+		return s.accountList()
+	case "account get-access-token":
+		return marshal(map[string]interface{}{
+			"accessToken":  "simulated-token",
+			"expiresOn":    time.Now().Add(time.Hour).Format("2006-01-02 15:04:05.000000"),
+			"expires_on":   time.Now().Add(time.Hour).Unix(),
+			"subscription": SubscriptionId,
+			"tenant":       TenantId,
+			"tokenType":    "Bearer",
+		})
+	case "cloud show":
+		return s.cloudShow(flags)
+	case "cloud set":
+		return s.cloudSet(flags)
+	case "rest":
+		return s.rest(flags)
+	case "ad app list":
+		return s.appList(flags)
+	case "ad app create":
+		return s.appCreate(flags)
+	case "ad app show":
+		return s.appShow(flags)
+	case "ad app update":
+		return s.appUpdate(flags)
+	case "ad app delete":
+		return s.appDelete(flags)
+	case "ad app credential reset":
+		return s.credentialReset(flags)
+	case "ad app credential delete":
+		return s.credentialDelete(flags)
+	case "ad app federated-credential create":
+		if s.graph() {
+			return s.federatedCredentialCreate(flags)
+		}
+	case "ad sp create":
+		return s.spCreate(flags)
+	case "ad sp show":
+		return s.spShow(flags)
+	case "role assignment create":
+		return s.roleAssignmentCreate(flags)
+	case "role assignment list":
+		return s.roleAssignmentList(flags)
+	case "role assignment delete":
+		return s.roleAssignmentDelete(flags)
+	case "keyvault show":
+		return s.keyVaultShow(flags)
+	case "keyvault create":
+		return s.keyVaultCreate(flags)
+	case "keyvault secret set":
+		return marshal(map[string]string{"id": fmt.Sprintf("https://%s.vault.azure.net/secrets/%s", flags.get("--vault-name"), flags.get("--name"))})
+	}
+
+	return failure(fmt.Sprintf("ERROR: '%s' is misspelled or not recognized by the system.", strings.Join(args, " ")))
+}
+
+// atLeast reports whether the simulated azure-cli is the version or newer.
+func (s *Simulator) atLeast(version string) bool {
+	curr, err := semver.NewVersion(s.config.Version)
+	if err != nil {
+		return false
+	}
+	min, _ := semver.NewVersion(version)
+	return !curr.LessThan(min)
+}
+
+// graph reports whether the `az ad` commands speak Microsoft Graph, as they
+// do since 2.37.0.
+func (s *Simulator) graph() bool {
+	return s.atLeast("2.37.0")
+}
+
+// removedFlags are the flags of each command that Microsoft Graph dropped,
+// and addedFlags those it introduced.
+var (
+	removedFlags = map[string][]string{
+		"ad app create":           {"--password", "--homepage"},
+		"ad app credential reset": {"--password"},
+	}
+	addedFlags = map[string][]string{
+		"ad app create": {"--web-home-page-url"},
+	}
+)
+
+// unrecognized returns the flags the command does not take in the dialect
+// of the simulated azure-cli.
+func (s *Simulator) unrecognized(command string, flags flags) []string {
+	unknown := addedFlags[command]
+	if s.graph() {
+		unknown = removedFlags[command]
+	}
+
+	var result []string
+	for _, flag := range unknown {
+		if flags.has(flag) {
+			result = append(result, flag)
+		}
+	}
+	return result
+}
+
+// object marshals an application or service principal as the dialect of the
+// simulated azure-cli shows it: Microsoft Graph names the object id id and
+// adds DateTime to the dates of password credentials.
+func (s *Simulator) object(v interface{}) (string, error) {
+	if !s.graph() {
+		return marshal(v)
+	}
+
+	output, err := json.Marshal(v)
+	if err != nil {
+		return failure(fmt.Sprintf("ERROR: %s", err))
+	}
+	object := map[string]interface{}{}
+	json.Unmarshal(output, &object)
+
+	object["id"] = object["objectId"]
+	delete(object, "objectId")
+	if homepage, ok := object["homepage"]; ok {
+		object["web"] = map[string]interface{}{"homePageUrl": homepage}
+		delete(object, "homepage")
+	}
+	if credentials, ok := object["passwordCredentials"].([]interface{}); ok {
+		for _, c := range credentials {
+			credential := c.(map[string]interface{})
+			credential["startDateTime"] = credential["startDate"]
+			credential["endDateTime"] = credential["endDate"]
+			delete(credential, "startDate")
+			delete(credential, "endDate")
+		}
+	}
+
+	return marshal(object)
+}
+
+// throttled records the call and reports whether there were already as many
+// calls in the last second as the config allows.
+func (s *Simulator) throttled() bool {
+	if s.config.CallsPerSecond <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	recent := s.calls[:0]
+	for _, call := range s.calls {
+		if now.Sub(call) < time.Second {
+			recent = append(recent, call)
+		}
+	}
+	s.calls = recent
+
+	if float64(len(s.calls)) >= s.config.CallsPerSecond {
+		return true
+	}
+
+	s.calls = append(s.calls, now)
+	return false
+}
+
+func (s *Simulator) accountList() (string, error) {
+	return marshal([]map[string]interface{}{
+		{
+			"name":      "simulated-subscription",
+			"id":        SubscriptionId,
+			"tenantId":  TenantId,
+			"state":     "Enabled",
+			"isDefault": true,
+			"user":      map[string]string{"name": User, "type": "user"},
+		},
+	})
+}
+
+// clouds are the clouds registered with the simulated azure-cli.
+var clouds = map[string]map[string]string{
+	"AzureCloud": {
+		"activeDirectory":                "https://login.microsoftonline.com",
+		"activeDirectoryGraphResourceId": "https://graph.windows.net/",
+		"microsoftGraphResourceId":       "https://graph.microsoft.com/",
+		"resourceManager":                "https://management.azure.com/",
+		"management":                     "https://management.core.windows.net/",
+	},
+	"AzureUSGovernment": {
+		"activeDirectory":                "https://login.microsoftonline.us",
+		"activeDirectoryGraphResourceId": "https://graph.windows.net/",
+		"microsoftGraphResourceId":       "https://graph.microsoft.us/",
+		"resourceManager":                "https://management.usgovcloudapi.net/",
+		"management":                     "https://management.core.usgovcloudapi.net/",
+	},
+}
+
+func (s *Simulator) cloudShow(flags flags) (string, error) {
+	name := flags.get("--name")
+	if name == "" {
+		name = s.activeCloud
+	}
+	endpoints, ok := clouds[name]
+	if !ok {
+		return failure(fmt.Sprintf("ERROR: The cloud '%s' is not registered.", name))
+	}
+
+	return marshal(map[string]interface{}{
+		"name":      name,
+		"isActive":  name == s.activeCloud,
+		"endpoints": endpoints,
+	})
+}
+
+func (s *Simulator) cloudSet(flags flags) (string, error) {
+	name := flags.get("--name")
+	if _, ok := clouds[name]; !ok {
+		return failure(fmt.Sprintf("ERROR: The cloud '%s' is not registered.", name))
+	}
+
+	s.activeCloud = name
+	return "", nil
+}
+
+func (s *Simulator) rest(flags flags) (string, error) {
+	url := flags.get("--url")
+	switch {
+	case strings.HasSuffix(url, "/v1.0/domains"):
+		return marshal(map[string]interface{}{
+			"value": []map[string]interface{}{{"id": Domain, "isVerified": true}},
+		})
+	case strings.HasSuffix(url, "/v1.0/me/transitiveMemberOf"):
+		return marshal(map[string]interface{}{
+			"value": []map[string]interface{}{
+				{"@odata.type": "#microsoft.graph.directoryRole", "displayName": "Application Administrator"},
+			},
+		})
+	case strings.HasSuffix(url, "/v1.0/policies/authorizationPolicy"):
+		return marshal(map[string]interface{}{
+			"defaultUserRolePermissions": map[string]interface{}{"allowedToCreateApps": false},
+		})
+	}
+
+	return failure(fmt.Sprintf("ERROR: Not Found({\"error\":{\"code\":\"Request_ResourceNotFound\",\"message\":\"Resource '%s' does not exist.\"}})", flags.get("--url")))
+}
+
+func marshal(v interface{}) (string, error) {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return failure(fmt.Sprintf("ERROR: %s", err))
+	}
+	return string(output) + "\n", nil
+}
+
+// failure is the stderr and exit status of a failed azure-cli command.
+func failure(message string) (string, error) {
+	return message + "\n", errors.New("exit status 1")
+}
+
+func newId() string {
+	return uuid.Must(uuid.NewRandom()).String()
+}
+
+type flags map[string][]string
+
+func (f flags) has(name string) bool {
+	_, ok := f[name]
+	return ok
+}
+
+func (f flags) get(name string) string {
+	values := f[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// parse splits the arguments into the command, the words before the first
+// flag, and the values of each flag.
+func parse(args []string) (string, flags) {
+	var words []string
+	i := 0
+	for ; i < len(args) && !strings.HasPrefix(args[i], "-"); i++ {
+		words = append(words, args[i])
+	}
+
+	f := flags{}
+	var current string
+	for ; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			current = args[i]
+			if _, ok := f[current]; !ok {
+				f[current] = nil
+			}
+			continue
+		}
+		f[current] = append(f[current], args[i])
+	}
+
+	return strings.Join(words, " "), f
+}
@@ -0,0 +1,201 @@
+package simulator_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+	"github.com/genevieve/az-automation/simulator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulator", func() {
+	var (
+		sim   *simulator.Simulator
+		azure *az.Az
+		ctx   context.Context
+	)
+
+	BeforeEach(func() {
+		sim = simulator.New(simulator.Config{})
+		azure = az.NewAz(sim, &fakes.Logger{}).WithDialect(az.MicrosoftGraph)
+		ctx = context.Background()
+	})
+
+	It("answers the version and login checks", func() {
+		version, err := azure.Version(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version.Core).To(Equal(simulator.Version))
+		Expect(version.Dialect()).To(Equal(az.MicrosoftGraph))
+
+		account, err := azure.LoggedIn(ctx, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(account.Id).To(Equal(simulator.SubscriptionId))
+		Expect(account.TenantId).To(Equal(simulator.TenantId))
+
+		cloud, _, err := azure.SelectCloud(ctx, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cloud.Name).To(Equal("AzureCloud"))
+
+		domains, err := azure.VerifiedDomains(ctx, cloud.GraphEndpoint())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(domains).To(Equal([]string{simulator.Domain}))
+	})
+
+	It("provisions and deletes a principal", func() {
+		clientId, secret, err := azure.CreateApplication(ctx, "some-password", "some-app", "", time.Now().AddDate(1, 0, 0))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret).NotTo(BeEmpty())
+		Expect(secret).NotTo(Equal("some-password"))
+
+		_, _, err = az.NewAz(sim, &fakes.Logger{}).CreateApplication(ctx, "some-password", "other-app", "", time.Time{})
+		Expect(err).To(MatchError(ContainSubstring("unrecognized arguments: --password")))
+
+		Expect(azure.SetIdentifierUri(ctx, clientId, "api://"+clientId)).To(Succeed())
+
+		objectId, err := azure.CreateServicePrincipal(ctx, clientId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objectId).NotTo(BeEmpty())
+
+		id, err := azure.AssignRole(ctx, clientId, "Contributor", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(HavePrefix("/subscriptions/" + simulator.SubscriptionId + "/providers/Microsoft.Authorization/roleAssignments/"))
+
+		application, err := azure.ShowApplication(ctx, "api://"+clientId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(application.AppId).To(Equal(clientId))
+		Expect(application.Id).NotTo(BeEmpty())
+		Expect(application.PasswordCredentials).To(HaveLen(1))
+
+		assignments, err := azure.ListRoleAssignments(ctx, clientId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(assignments).To(Equal([]az.RoleAssignment{{Id: id, RoleDefinitionName: "Contributor", Scope: "/subscriptions/" + simulator.SubscriptionId}}))
+
+		Expect(azure.DeleteApplication(ctx, clientId)).To(Succeed())
+
+		_, err = azure.ShowApplication(ctx, clientId)
+		Expect(err).To(MatchError(ContainSubstring("does not exist")))
+
+		output, err := sim.Execute(ctx, []string{"role", "assignment", "list", "--all"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring(id))
+		Expect(output).To(ContainSubstring(`"principalType": "Unknown"`))
+
+		Expect(azure.DeleteRoleAssignment(ctx, id)).To(Succeed())
+		output, err = sim.Execute(ctx, []string{"role", "assignment", "list", "--all"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).NotTo(ContainSubstring(id))
+	})
+
+	It("matches display names by prefix", func() {
+		_, _, err := azure.CreateApplication(ctx, "", "some-app-2", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(azure.AppExists(ctx, "some-app")).To(Succeed())
+
+		name, err := azure.AvailableDisplayName(ctx, "Some-App-2", "sequential")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("Some-App-2-2"))
+	})
+
+	It("rejects identifier uris that are taken", func() {
+		_, _, err := azure.CreateApplication(ctx, "", "some-app", "https://some-app."+simulator.Domain, time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = azure.CreateApplication(ctx, "", "other-app", "https://some-app."+simulator.Domain, time.Time{})
+		Expect(err).To(MatchError(ContainSubstring("Another object with the same value for property identifierUris already exists.")))
+
+		Expect(azure.IdentifierUriExists(ctx, "https://some-app."+simulator.Domain)).To(MatchError(ContainSubstring("is taken by application")))
+	})
+
+	It("rejects a second service principal and role assignment", func() {
+		clientId, _, err := azure.CreateApplication(ctx, "", "some-app", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = azure.CreateServicePrincipal(ctx, clientId)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = azure.CreateServicePrincipal(ctx, clientId)
+		Expect(err).To(MatchError(ContainSubstring("Another object with the same value for property servicePrincipalNames already exists.")))
+
+		_, err = azure.AssignRole(ctx, clientId, "Reader", "")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = azure.AssignRole(ctx, clientId, "Reader", "")
+		Expect(err).To(MatchError(ContainSubstring("The role assignment already exists.")))
+
+		_, err = azure.AssignRole(ctx, clientId, "Wizard", "")
+		Expect(err).To(MatchError(ContainSubstring("Role 'Wizard' doesn't exist.")))
+	})
+
+	Context("with an azure-cli older than 2.37.0", func() {
+		BeforeEach(func() {
+			sim = simulator.New(simulator.Config{Version: "2.30.0"})
+			azure = az.NewAz(sim, &fakes.Logger{})
+		})
+
+		It("speaks Azure AD Graph", func() {
+			version, err := azure.Version(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version.Dialect()).To(Equal(az.AzureADGraph))
+
+			clientId, secret, err := azure.CreateApplication(ctx, "some-password", "some-app", "https://some-app."+simulator.Domain, time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret).To(Equal("some-password"))
+
+			application, err := azure.ShowApplication(ctx, clientId)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(application.Id).NotTo(BeEmpty())
+			Expect(application.PasswordCredentials[0].EndDate).NotTo(BeEmpty())
+
+			_, _, err = azure.WithDialect(az.MicrosoftGraph).CreateApplication(ctx, "", "other-app", "https://other-app."+simulator.Domain, time.Time{})
+			Expect(err).To(MatchError(ContainSubstring("unrecognized arguments: --web-home-page-url")))
+		})
+	})
+
+	Context("with a replication delay", func() {
+		BeforeEach(func() {
+			sim = simulator.New(simulator.Config{ReplicationDelay: 100 * time.Millisecond})
+			azure = az.NewAz(sim, &fakes.Logger{}).WithDialect(az.MicrosoftGraph)
+		})
+
+		It("cannot assign roles to a new service principal until it has replicated", func() {
+			clientId, _, err := azure.CreateApplication(ctx, "", "some-app", "", time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = azure.CreateServicePrincipal(ctx, clientId)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = azure.AssignRole(ctx, clientId, "Contributor", "")
+			Expect(err).To(MatchError(ContainSubstring("does not exist in the directory")))
+
+			time.Sleep(100 * time.Millisecond)
+
+			_, err = azure.AssignRole(ctx, clientId, "Contributor", "")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with throttling", func() {
+		BeforeEach(func() {
+			sim = simulator.New(simulator.Config{CallsPerSecond: 2})
+		})
+
+		It("rejects the calls beyond the rate", func() {
+			_, err := sim.Execute(ctx, []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = sim.Execute(ctx, []string{"account", "list"})
+			Expect(err).NotTo(HaveOccurred())
+
+			output, err := sim.Execute(ctx, []string{"account", "list"})
+			Expect(err).To(HaveOccurred())
+			Expect(output).To(ContainSubstring("Too Many Requests"))
+		})
+	})
+
+	It("rejects unknown commands", func() {
+		output, err := sim.Execute(ctx, []string{"vm", "list"})
+		Expect(err).To(HaveOccurred())
+		Expect(output).To(ContainSubstring("'vm list' is misspelled or not recognized by the system."))
+	})
+})
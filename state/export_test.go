@@ -0,0 +1,7 @@
+package state
+
+import "time"
+
+func SetLockWait(wait time.Duration) {
+	lockWait = wait
+}
@@ -0,0 +1,244 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const version = 1
+
+// lockWait bounds how long Open waits for another run to release the state.
+var lockWait = 30 * time.Second
+
+type RoleAssignment struct {
+	Id    string `json:"id"`
+	Role  string `json:"role"`
+	Scope string `json:"scope"`
+}
+
+type Credential struct {
+	KeyId     string `json:"key_id"`
+	ExpiresOn string `json:"expires_on,omitempty"`
+}
+
+// Principal is everything the tool knows about an application it created or
+// imported. Run holds the account and options it was created with, so its
+// secret can be rotated to the same outputs; imported principals have none.
+type Principal struct {
+	DisplayName        string           `json:"display_name"`
+	AppId              string           `json:"app_id"`
+	ObjectId           string           `json:"object_id,omitempty"`
+	ServicePrincipalId string           `json:"service_principal_id,omitempty"`
+	TenantId           string           `json:"tenant_id"`
+	Cloud              string           `json:"cloud,omitempty"`
+	Subscriptions      []string         `json:"subscriptions,omitempty"`
+	RoleAssignments    []RoleAssignment `json:"role_assignments,omitempty"`
+	Credentials        []Credential     `json:"credentials,omitempty"`
+	Outputs            []string         `json:"outputs,omitempty"`
+	Imported           bool             `json:"imported,omitempty"`
+	CreatedAt          time.Time        `json:"created_at"`
+	UpdatedAt          time.Time        `json:"updated_at"`
+	Run                json.RawMessage  `json:"run,omitempty"`
+}
+
+type file struct {
+	Version    int         `json:"version"`
+	Principals []Principal `json:"principals"`
+}
+
+type State struct {
+	path       string
+	lock       string
+	principals []Principal
+	mutex      *sync.Mutex
+}
+
+// Open locks the state file at path for as long as it is in use and reads
+// it. A state file that does not exist yet is empty.
+func Open(path string) (*State, error) {
+	lock := path + ".lock"
+	err := acquire(lock)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{
+		path:  path,
+		lock:  lock,
+		mutex: &sync.Mutex{},
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		os.Remove(lock)
+		return nil, errors.New(fmt.Sprintf("Reading state file: %s", err))
+	}
+
+	f := file{}
+	err = json.Unmarshal(contents, &f)
+	if err != nil {
+		os.Remove(lock)
+		return nil, errors.New(fmt.Sprintf("Unmarshalling state json: %s", err))
+	}
+
+	if f.Version > version {
+		os.Remove(lock)
+		return nil, errors.New(fmt.Sprintf("The state file %s is from a newer version of az-automation.", path))
+	}
+
+	s.principals = f.Principals
+	return s, nil
+}
+
+func acquire(lock string) error {
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return f.Close()
+		}
+		if !os.IsExist(err) {
+			return errors.New(fmt.Sprintf("Locking state file: %s", err))
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New(fmt.Sprintf("The state file is locked by another run. If none is running, remove %s.", lock))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Close releases the lock on the state file.
+func (s *State) Close() error {
+	err := os.Remove(s.lock)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Unlocking state file: %s", err))
+	}
+	return nil
+}
+
+// Principals returns the principals in the order they were created.
+func (s *State) Principals() []Principal {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Principal{}, s.principals...)
+}
+
+// Find returns the principal with the app id, or else the display name. A
+// display name shared by several principals is rejected rather than guessed.
+func (s *State) Find(appIdOrName string) (Principal, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var found []Principal
+	for _, p := range s.principals {
+		if strings.EqualFold(p.AppId, appIdOrName) {
+			return p, nil
+		}
+		if p.DisplayName == appIdOrName {
+			found = append(found, p)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Principal{}, errors.New(fmt.Sprintf("There is no principal %s in the state file.", appIdOrName))
+	case 1:
+		return found[0], nil
+	default:
+		return Principal{}, errors.New(fmt.Sprintf("The display name %s matches %d principals. Please use the app id of one of them.", appIdOrName, len(found)))
+	}
+}
+
+// Put adds the principal, or replaces the one with the same app id, and
+// saves the state.
+func (s *State) Put(principal Principal) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	if principal.CreatedAt.IsZero() {
+		principal.CreatedAt = now
+	}
+	principal.UpdatedAt = now
+
+	for i, p := range s.principals {
+		if p.AppId == principal.AppId {
+			principal.CreatedAt = p.CreatedAt
+			s.principals[i] = principal
+			return s.save()
+		}
+	}
+
+	s.principals = append(s.principals, principal)
+	return s.save()
+}
+
+// Remove forgets the principal with the app id and saves the state.
+func (s *State) Remove(appId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, p := range s.principals {
+		if p.AppId == appId {
+			s.principals = append(s.principals[:i], s.principals[i+1:]...)
+			return s.save()
+		}
+	}
+	return nil
+}
+
+// save writes the state to a temporary file and renames it into place, so a
+// crash never leaves a partial state file behind.
+func (s *State) save() error {
+	contents, err := json.MarshalIndent(file{Version: version, Principals: s.principals}, "", "  ")
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling state json: %s", err))
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing state file: %s", err))
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(append(contents, '\n'))
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing state file: %s", err))
+	}
+
+	err = os.Rename(temp.Name(), s.path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing state file: %s", err))
+	}
+
+	return nil
+}
+
+// SubscriptionOf returns the subscription id of a scope such as
+// /subscriptions/<id>/resourceGroups/<name>, or nothing for other scopes.
+func SubscriptionOf(scope string) string {
+	parts := strings.Split(strings.Trim(scope, "/"), "/")
+	if len(parts) >= 2 && strings.EqualFold(parts[0], "subscriptions") {
+		return parts[1]
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package state_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/genevieve/az-automation/state"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "state")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(dir, "az-automation.state.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("saves principals so they can be read back", func() {
+		s, err := state.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Principals()).To(BeEmpty())
+
+		Expect(s.Put(state.Principal{
+			DisplayName:     "team-a",
+			AppId:           "a-id",
+			TenantId:        "tenant-id",
+			RoleAssignments: []state.RoleAssignment{{Id: "assignment-id", Role: "Reader", Scope: "/subscriptions/1234"}},
+			Credentials:     []state.Credential{{KeyId: "key-id", ExpiresOn: "2020-01-02T03:04:05Z"}},
+			Outputs:         []string{"file:team-a.tfvars"},
+			Run:             json.RawMessage(`{"account":"1234"}`),
+		})).To(Succeed())
+		Expect(s.Put(state.Principal{DisplayName: "team-b", AppId: "b-id"})).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		s, err = state.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		principals := s.Principals()
+		Expect(principals).To(HaveLen(2))
+		Expect(principals[0].DisplayName).To(Equal("team-a"))
+		Expect(principals[0].RoleAssignments[0].Id).To(Equal("assignment-id"))
+		Expect(principals[0].Credentials[0].KeyId).To(Equal("key-id"))
+		Expect(principals[0].Run).To(MatchJSON(`{"account":"1234"}`))
+		Expect(principals[0].CreatedAt).NotTo(BeZero())
+		Expect(principals[1].AppId).To(Equal("b-id"))
+	})
+
+	It("replaces a principal with the same app id and keeps when it was created", func() {
+		s, err := state.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		Expect(s.Put(state.Principal{DisplayName: "team-a", AppId: "a-id"})).To(Succeed())
+		created := s.Principals()[0].CreatedAt
+
+		Expect(s.Put(state.Principal{DisplayName: "team-a", AppId: "a-id", ServicePrincipalId: "sp-id"})).To(Succeed())
+
+		principals := s.Principals()
+		Expect(principals).To(HaveLen(1))
+		Expect(principals[0].ServicePrincipalId).To(Equal("sp-id"))
+		Expect(principals[0].CreatedAt).To(Equal(created))
+	})
+
+	It("removes principals", func() {
+		s, err := state.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+
+		Expect(s.Put(state.Principal{DisplayName: "team-a", AppId: "a-id"})).To(Succeed())
+		Expect(s.Put(state.Principal{DisplayName: "team-b", AppId: "b-id"})).To(Succeed())
+		Expect(s.Remove("a-id")).To(Succeed())
+
+		Expect(s.Principals()).To(HaveLen(1))
+		Expect(s.Principals()[0].AppId).To(Equal("b-id"))
+	})
+
+	Describe("Find", func() {
+		var s *state.State
+
+		BeforeEach(func() {
+			var err error
+			s, err = state.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(s.Put(state.Principal{DisplayName: "team-a", AppId: "a-id"})).To(Succeed())
+			Expect(s.Put(state.Principal{DisplayName: "shared", AppId: "b-id"})).To(Succeed())
+			Expect(s.Put(state.Principal{DisplayName: "shared", AppId: "c-id"})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			s.Close()
+		})
+
+		It("finds principals by app id or display name", func() {
+			p, err := s.Find("A-ID")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.DisplayName).To(Equal("team-a"))
+
+			p, err = s.Find("team-a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.AppId).To(Equal("a-id"))
+		})
+
+		It("rejects display names shared by several principals", func() {
+			_, err := s.Find("shared")
+			Expect(err).To(MatchError("The display name shared matches 2 principals. Please use the app id of one of them."))
+		})
+
+		It("returns a helpful error for unknown principals", func() {
+			_, err := s.Find("banana")
+			Expect(err).To(MatchError("There is no principal banana in the state file."))
+		})
+	})
+
+	Context("when the state file is locked", func() {
+		BeforeEach(func() {
+			state.SetLockWait(100 * time.Millisecond)
+		})
+
+		AfterEach(func() {
+			state.SetLockWait(30 * time.Second)
+		})
+
+		It("returns a helpful error", func() {
+			Expect(ioutil.WriteFile(path+".lock", []byte("1\n"), 0600)).To(Succeed())
+
+			_, err := state.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("The state file is locked by another run.")))
+		})
+	})
+
+	Context("when the state file is from a newer version", func() {
+		It("returns a helpful error", func() {
+			Expect(ioutil.WriteFile(path, []byte(`{"version": 2, "principals": []}`), 0600)).To(Succeed())
+
+			_, err := state.Open(path)
+			Expect(err).To(MatchError(ContainSubstring("is from a newer version of az-automation.")))
+
+			_, err = os.Stat(path + ".lock")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Describe("SubscriptionOf", func() {
+		It("returns the subscription of a scope", func() {
+			Expect(state.SubscriptionOf("/subscriptions/1234/resourceGroups/some-group")).To(Equal("1234"))
+			Expect(state.SubscriptionOf("/subscriptions/1234")).To(Equal("1234"))
+			Expect(state.SubscriptionOf("/providers/Microsoft.Management/managementGroups/some-group")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/genevieve/az-automation/az"
+)
+
+type CredHubConfig struct {
+	Server       string
+	Client       string
+	ClientSecret string
+	Name         string
+	TLS          TLSConfig
+}
+
+type CredHub struct {
+	config CredHubConfig
+	logger logger
+}
+
+func NewCredHub(config CredHubConfig, logger logger) CredHub {
+	return CredHub{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Validate checks the server and client of CredHub are known and its CA
+// certificate can be read, so that a run can fail before it creates anything.
+func (c CredHub) Validate() error {
+	if c.config.Server == "" || c.config.Client == "" || c.config.ClientSecret == "" {
+		return errors.New("Please set CREDHUB_SERVER, CREDHUB_CLIENT and CREDHUB_SECRET to use the credhub sink.")
+	}
+
+	_, err := newHTTPClient(c.config.TLS)
+	return err
+}
+
+// Write stores the credentials as a json credential. The access token is
+// requested with the client credentials grant from the UAA that the CredHub
+// server advertises in its info endpoint.
+func (c CredHub) Write(ctx context.Context, credentials az.Credentials) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient(c.config.TLS)
+	if err != nil {
+		return err
+	}
+
+	server := strings.TrimSuffix(c.config.Server, "/")
+
+	token, err := c.accessToken(ctx, client, server)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"name":  c.config.Name,
+		"type":  "json",
+		"value": values(credentials),
+	})
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling credhub credential json: %s", err))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "PUT", server+"/api/v1/data", bytes.NewReader(body))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Creating credhub request: %s", err))
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing credentials to credhub: %s", err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		output, _ := ioutil.ReadAll(response.Body)
+		return errors.New(fmt.Sprintf("Writing credentials to credhub returned %d: %s", response.StatusCode, strings.TrimSpace(string(output))))
+	}
+
+	c.logger.Info(fmt.Sprintf("Wrote credentials to credhub at %s.", c.config.Name), az.F("step", "write-credentials"), az.F("app_id", credentials.ClientId))
+	return nil
+}
+
+func (c CredHub) accessToken(ctx context.Context, client *http.Client, server string) (string, error) {
+	infoRequest, err := http.NewRequestWithContext(ctx, "GET", server+"/info", nil)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Creating credhub info request: %s", err))
+	}
+
+	response, err := client.Do(infoRequest)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Getting credhub info: %s", err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("Getting credhub info returned %d.", response.StatusCode))
+	}
+
+	info := struct {
+		AuthServer struct {
+			URL string `json:"url"`
+		} `json:"auth-server"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&info)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unmarshalling credhub info json: %s", err))
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.config.Client},
+		"client_secret": {c.config.ClientSecret},
+		"response_type": {"token"},
+	}
+
+	tokenRequest, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(info.AuthServer.URL, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Creating uaa token request: %s", err))
+	}
+	tokenRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	tokenResponse, err := client.Do(tokenRequest)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Getting uaa token: %s", err))
+	}
+	defer tokenResponse.Body.Close()
+
+	if tokenResponse.StatusCode != http.StatusOK {
+		output, _ := ioutil.ReadAll(tokenResponse.Body)
+		return "", errors.New(fmt.Sprintf("Getting uaa token returned %d: %s", tokenResponse.StatusCode, strings.TrimSpace(string(output))))
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(tokenResponse.Body).Decode(&token)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unmarshalling uaa token json: %s", err))
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,123 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+	"github.com/genevieve/az-automation/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CredHub", func() {
+	var (
+		server      *httptest.Server
+		logger      *fakes.Logger
+		config      store.CredHubConfig
+		credentials az.Credentials
+
+		tokenForm     map[string]string
+		authorization string
+		credential    struct {
+			Name  string            `json:"name"`
+			Type  string            `json:"type"`
+			Value map[string]string `json:"value"`
+		}
+		tokenStatus int
+	)
+
+	BeforeEach(func() {
+		tokenStatus = http.StatusOK
+		mux := http.NewServeMux()
+		server = httptest.NewTLSServer(mux)
+
+		mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"auth-server": {"url": "%s/uaa"}}`, server.URL)
+		})
+		mux.HandleFunc("/uaa/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			tokenForm = map[string]string{
+				"grant_type":    r.PostForm.Get("grant_type"),
+				"client_id":     r.PostForm.Get("client_id"),
+				"client_secret": r.PostForm.Get("client_secret"),
+			}
+			w.WriteHeader(tokenStatus)
+			w.Write([]byte(`{"access_token": "some-access-token"}`))
+		})
+		mux.HandleFunc("/api/v1/data", func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			json.NewDecoder(r.Body).Decode(&credential)
+			w.Write([]byte(`{}`))
+		})
+
+		logger = &fakes.Logger{}
+		config = store.CredHubConfig{
+			Server:       server.URL,
+			Client:       "some-client",
+			ClientSecret: "some-client-secret",
+			Name:         "/concourse/main/azure",
+			TLS:          store.TLSConfig{InsecureSkipVerify: true},
+		}
+		credentials = az.Credentials{
+			SubscriptionId:   "subscription-id",
+			TenantId:         "tenant-id",
+			ClientId:         "client-id",
+			FederatedSubject: "some-subject",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Write", func() {
+		It("writes the credentials as a json credential using a uaa token", func() {
+			err := store.NewCredHub(config, logger).Write(context.Background(), credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tokenForm).To(Equal(map[string]string{
+				"grant_type":    "client_credentials",
+				"client_id":     "some-client",
+				"client_secret": "some-client-secret",
+			}))
+			Expect(authorization).To(Equal("Bearer some-access-token"))
+			Expect(credential.Name).To(Equal("/concourse/main/azure"))
+			Expect(credential.Type).To(Equal("json"))
+			Expect(credential.Value).To(Equal(map[string]string{
+				"subscription_id":   "subscription-id",
+				"tenant_id":         "tenant-id",
+				"client_id":         "client-id",
+				"federated_subject": "some-subject",
+			}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Wrote credentials to credhub at /concourse/main/azure."))
+		})
+
+		Context("when the uaa rejects the client", func() {
+			BeforeEach(func() {
+				tokenStatus = http.StatusUnauthorized
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewCredHub(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError(ContainSubstring("Getting uaa token returned 401: ")))
+			})
+		})
+
+		Context("when the client is missing", func() {
+			BeforeEach(func() {
+				config.Client = ""
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewCredHub(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError("Please set CREDHUB_SERVER, CREDHUB_CLIENT and CREDHUB_SECRET to use the credhub sink."))
+			})
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/genevieve/az-automation/az"
+)
+
+type TLSConfig struct {
+	CACertFile         string
+	InsecureSkipVerify bool
+}
+
+type logger interface {
+	Debug(message string, fields ...az.Field)
+	Info(message string, fields ...az.Field)
+	Warn(message string, fields ...az.Field)
+	Error(message string, fields ...az.Field)
+}
+
+// newHTTPClient is a client with the TLS config that otherwise behaves like
+// the default one, going through the proxy in HTTPS_PROXY unless NO_PROXY
+// says otherwise.
+func newHTTPClient(config TLSConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CACertFile != "" {
+		pem, err := ioutil.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Reading ca certificate: %s", err))
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("The ca certificate %s does not contain any pem encoded certificates.", config.CACertFile))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}, nil
+}
+
+func values(credentials az.Credentials) map[string]string {
+	v := map[string]string{
+		"subscription_id": credentials.SubscriptionId,
+		"tenant_id":       credentials.TenantId,
+		"client_id":       credentials.ClientId,
+	}
+
+	if credentials.DisplayName != "" {
+		v["display_name"] = credentials.DisplayName
+	}
+
+	if credentials.ClientSecret != "" {
+		v["client_secret"] = credentials.ClientSecret
+	}
+
+	if credentials.FederatedSubject != "" {
+		v["federated_subject"] = credentials.FederatedSubject
+	}
+
+	if credentials.Cloud.Name != "" {
+		v["environment"] = credentials.Cloud.Name
+		v["resource_manager_endpoint"] = credentials.Cloud.Endpoints.ResourceManager
+		v["active_directory_endpoint"] = credentials.Cloud.Endpoints.ActiveDirectory
+		v["graph_endpoint"] = credentials.Cloud.GraphEndpoint()
+	}
+
+	return v
+}
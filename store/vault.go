@@ -0,0 +1,94 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/genevieve/az-automation/az"
+)
+
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+	TLS       TLSConfig
+}
+
+type Vault struct {
+	config VaultConfig
+	logger logger
+}
+
+func NewVault(config VaultConfig, logger logger) Vault {
+	return Vault{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Validate checks the address and token of Vault are known and its CA
+// certificate can be read, so that a run can fail before it creates anything.
+func (v Vault) Validate() error {
+	if v.config.Address == "" || v.config.Token == "" {
+		return errors.New("Please set VAULT_ADDR and VAULT_TOKEN to use the vault sink.")
+	}
+
+	_, err := newHTTPClient(v.config.TLS)
+	return err
+}
+
+// Write stores the credentials as a single secret in a KV version 2 secrets
+// engine, creating a new version if the path already exists.
+func (v Vault) Write(ctx context.Context, credentials az.Credentials) error {
+	err := v.Validate()
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient(v.config.TLS)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"data": values(credentials)})
+	if err != nil {
+		return errors.New(fmt.Sprintf("Marshalling vault secret json: %s", err))
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s",
+		strings.TrimSuffix(v.config.Address, "/"),
+		strings.Trim(v.config.Mount, "/"),
+		strings.Trim(v.config.Path, "/"))
+
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Creating vault request: %s", err))
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Vault-Token", v.config.Token)
+	if v.config.Namespace != "" {
+		request.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Writing credentials to vault: %s", err))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		output, _ := ioutil.ReadAll(response.Body)
+		return errors.New(fmt.Sprintf("Writing credentials to vault returned %d: %s", response.StatusCode, strings.TrimSpace(string(output))))
+	}
+
+	v.logger.Info(fmt.Sprintf("Wrote credentials to vault at %s/%s.", strings.Trim(v.config.Mount, "/"), strings.Trim(v.config.Path, "/")), az.F("step", "write-credentials"), az.F("app_id", credentials.ClientId))
+	return nil
+}
@@ -0,0 +1,158 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+	"github.com/genevieve/az-automation/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Vault", func() {
+	var (
+		server      *httptest.Server
+		logger      *fakes.Logger
+		config      store.VaultConfig
+		credentials az.Credentials
+
+		request struct {
+			Method    string
+			Path      string
+			Token     string
+			Namespace string
+			Body      map[string]map[string]string
+		}
+		status int
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request.Method = r.Method
+			request.Path = r.URL.Path
+			request.Token = r.Header.Get("X-Vault-Token")
+			request.Namespace = r.Header.Get("X-Vault-Namespace")
+			json.NewDecoder(r.Body).Decode(&request.Body)
+
+			w.WriteHeader(status)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+		}))
+
+		logger = &fakes.Logger{}
+		config = store.VaultConfig{
+			Address:   server.URL,
+			Token:     "some-token",
+			Namespace: "some-namespace",
+			Mount:     "secret",
+			Path:      "azure/some-app",
+			TLS:       store.TLSConfig{InsecureSkipVerify: true},
+		}
+		credentials = az.Credentials{
+			SubscriptionId: "subscription-id",
+			TenantId:       "tenant-id",
+			ClientId:       "client-id",
+			ClientSecret:   "client-secret",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Write", func() {
+		It("writes the credentials to the kv v2 path", func() {
+			err := store.NewVault(config, logger).Write(context.Background(), credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(request.Method).To(Equal("POST"))
+			Expect(request.Path).To(Equal("/v1/secret/data/azure/some-app"))
+			Expect(request.Token).To(Equal("some-token"))
+			Expect(request.Namespace).To(Equal("some-namespace"))
+			Expect(request.Body["data"]).To(Equal(map[string]string{
+				"subscription_id": "subscription-id",
+				"tenant_id":       "tenant-id",
+				"client_id":       "client-id",
+				"client_secret":   "client-secret",
+			}))
+			Expect(logger.InfoCall.Receives.Message).To(Equal("Wrote credentials to vault at secret/azure/some-app."))
+		})
+
+		Context("when the ca certificate of the server is provided", func() {
+			var caCertFile string
+
+			BeforeEach(func() {
+				file, err := ioutil.TempFile("", "ca")
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				err = pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+				Expect(err).NotTo(HaveOccurred())
+
+				caCertFile = file.Name()
+				config.TLS = store.TLSConfig{CACertFile: caCertFile}
+			})
+
+			AfterEach(func() {
+				os.Remove(caCertFile)
+			})
+
+			It("trusts the server", func() {
+				err := store.NewVault(config, logger).Write(context.Background(), credentials)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the server certificate is not trusted", func() {
+			BeforeEach(func() {
+				config.TLS = store.TLSConfig{}
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewVault(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError(ContainSubstring("Writing credentials to vault: ")))
+			})
+		})
+
+		Context("when the ca certificate file does not exist", func() {
+			BeforeEach(func() {
+				config.TLS = store.TLSConfig{CACertFile: "/banana/ca.crt"}
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewVault(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError(ContainSubstring("Reading ca certificate: ")))
+			})
+		})
+
+		Context("when vault rejects the request", func() {
+			BeforeEach(func() {
+				status = http.StatusForbidden
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewVault(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError(`Writing credentials to vault returned 403: {"errors": ["permission denied"]}`))
+			})
+		})
+
+		Context("when the token is missing", func() {
+			BeforeEach(func() {
+				config.Token = ""
+			})
+
+			It("returns a helpful error", func() {
+				err := store.NewVault(config, logger).Write(context.Background(), credentials)
+				Expect(err).To(MatchError("Please set VAULT_ADDR and VAULT_TOKEN to use the vault sink."))
+			})
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package wizard_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWizard(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "wizard")
+}
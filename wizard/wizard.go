@@ -0,0 +1,258 @@
+package wizard
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/genevieve/az-automation/az"
+)
+
+var Aborted = errors.New("Aborted.")
+
+var formats = []string{"tfvars", "kubernetes-secret", "azure-json", "sdk-auth"}
+
+var defaultFiles = map[string]string{
+	"tfvars":            "creds.tfvars",
+	"kubernetes-secret": "azure-credentials.yml",
+	"azure-json":        "azure.json",
+	"sdk-auth":          "sdk-auth.json",
+}
+
+type accounts interface {
+	ListAccounts(ctx context.Context) ([]az.Account, error)
+}
+
+type Answers struct {
+	Account                string
+	DisplayName            string
+	IdentifierUri          string
+	Roles                  []string
+	Scope                  string
+	CredentialOutputFormat string
+	CredentialOutputFile   string
+	ResourceGroup          string
+	Location               string
+}
+
+type Wizard struct {
+	reader   *bufio.Reader
+	writer   io.Writer
+	accounts accounts
+}
+
+func New(reader io.Reader, writer io.Writer, accounts accounts) Wizard {
+	return Wizard{
+		reader:   bufio.NewReader(reader),
+		writer:   writer,
+		accounts: accounts,
+	}
+}
+
+// Run asks for each answer in turn, offering the given answers as defaults,
+// and returns them once the summary has been confirmed.
+func (w Wizard) Run(ctx context.Context, defaults Answers) (Answers, error) {
+	answers := defaults
+
+	account, err := w.chooseAccount(ctx, defaults.Account)
+	if err != nil {
+		return Answers{}, err
+	}
+	answers.Account = account.Id
+
+	if answers.DisplayName == "" {
+		answers.DisplayName = proposeDisplayName(account.Name)
+	}
+	answers.DisplayName, err = w.ask("Display name", answers.DisplayName)
+	if err != nil {
+		return Answers{}, err
+	}
+
+	if answers.IdentifierUri == "" {
+		answers.IdentifierUri = az.AutoIdentifierUri
+	}
+	answers.IdentifierUri, err = w.ask("Identifier URI (auto for api://<app id>)", answers.IdentifierUri)
+	if err != nil {
+		return Answers{}, err
+	}
+
+	if len(answers.Roles) == 0 {
+		answers.Roles = []string{"Contributor"}
+	}
+	roles, err := w.ask("Roles (comma separated)", strings.Join(answers.Roles, ", "))
+	if err != nil {
+		return Answers{}, err
+	}
+	answers.Roles = splitList(roles)
+
+	answers.Scope, err = w.ask("Scope (empty for the whole subscription)", answers.Scope)
+	if err != nil {
+		return Answers{}, err
+	}
+
+	previousFormat := answers.CredentialOutputFormat
+	answers.CredentialOutputFormat, err = w.choose("Output format", formats, answers.CredentialOutputFormat)
+	if err != nil {
+		return Answers{}, err
+	}
+
+	if answers.CredentialOutputFormat == "azure-json" {
+		answers.ResourceGroup, err = w.askRequired("Resource group of the cluster", answers.ResourceGroup)
+		if err != nil {
+			return Answers{}, err
+		}
+
+		answers.Location, err = w.askRequired("Location of the cluster", answers.Location)
+		if err != nil {
+			return Answers{}, err
+		}
+	}
+
+	if answers.CredentialOutputFile == "" || answers.CredentialOutputFile == defaultFiles[previousFormat] {
+		answers.CredentialOutputFile = defaultFiles[answers.CredentialOutputFormat]
+	}
+	answers.CredentialOutputFile, err = w.ask("Output file", answers.CredentialOutputFile)
+	if err != nil {
+		return Answers{}, err
+	}
+
+	w.summarize(account, answers)
+
+	confirmed, err := w.ask("Create the service principal? [y/N]", "")
+	if err != nil {
+		return Answers{}, err
+	}
+	if !strings.HasPrefix(strings.ToLower(confirmed), "y") {
+		return Answers{}, Aborted
+	}
+
+	return answers, nil
+}
+
+func (w Wizard) chooseAccount(ctx context.Context, current string) (az.Account, error) {
+	accounts, err := w.accounts.ListAccounts(ctx)
+	if err != nil {
+		return az.Account{}, err
+	}
+
+	selected := 0
+	fmt.Fprintln(w.writer, "Accounts:")
+	for i, account := range accounts {
+		if account.Id == current || account.Name == current || (current == "" && account.IsDefault) {
+			selected = i
+		}
+		fmt.Fprintf(w.writer, "  %d) %s (%s)\n", i+1, account.Name, account.Id)
+	}
+
+	for {
+		answer, err := w.ask("Account", strconv.Itoa(selected+1))
+		if err != nil {
+			return az.Account{}, err
+		}
+
+		i, err := strconv.Atoi(answer)
+		if err == nil && i >= 1 && i <= len(accounts) {
+			return accounts[i-1], nil
+		}
+		fmt.Fprintf(w.writer, "Please enter a number between 1 and %d.\n", len(accounts))
+	}
+}
+
+func (w Wizard) choose(question string, choices []string, current string) (string, error) {
+	if current == "" {
+		current = choices[0]
+	}
+
+	for {
+		answer, err := w.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", ")), current)
+		if err != nil {
+			return "", err
+		}
+
+		for _, choice := range choices {
+			if answer == choice {
+				return answer, nil
+			}
+		}
+		fmt.Fprintf(w.writer, "Please enter one of %s.\n", strings.Join(choices, ", "))
+	}
+}
+
+// askRequired asks until the answer is not empty.
+func (w Wizard) askRequired(question, current string) (string, error) {
+	for {
+		answer, err := w.ask(question, current)
+		if err != nil {
+			return "", err
+		}
+		if answer != "" {
+			return answer, nil
+		}
+		fmt.Fprintln(w.writer, "Please enter a value.")
+	}
+}
+
+func (w Wizard) ask(question, current string) (string, error) {
+	if current == "" {
+		fmt.Fprintf(w.writer, "%s: ", question)
+	} else {
+		fmt.Fprintf(w.writer, "%s [%s]: ", question, current)
+	}
+
+	line, err := w.reader.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", Aborted
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return current, nil
+	}
+	return answer, nil
+}
+
+func (w Wizard) summarize(account az.Account, answers Answers) {
+	scope := answers.Scope
+	if scope == "" {
+		scope = fmt.Sprintf("/subscriptions/%s", account.Id)
+	}
+
+	fmt.Fprintln(w.writer, "")
+	fmt.Fprintln(w.writer, "Summary:")
+	fmt.Fprintf(w.writer, "  Account:        %s (%s)\n", account.Name, account.Id)
+	fmt.Fprintf(w.writer, "  Display name:   %s\n", answers.DisplayName)
+	fmt.Fprintf(w.writer, "  Identifier URI: %s\n", answers.IdentifierUri)
+	fmt.Fprintf(w.writer, "  Roles:          %s\n", strings.Join(answers.Roles, ", "))
+	fmt.Fprintf(w.writer, "  Scope:          %s\n", scope)
+	fmt.Fprintf(w.writer, "  Output:         %s (%s)\n", answers.CredentialOutputFile, answers.CredentialOutputFormat)
+	if answers.CredentialOutputFormat == "azure-json" {
+		fmt.Fprintf(w.writer, "  Cluster:        %s (%s)\n", answers.ResourceGroup, answers.Location)
+	}
+	fmt.Fprintln(w.writer, "")
+}
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+func proposeDisplayName(accountName string) string {
+	name := strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(accountName), "-"), "-")
+	if name == "" {
+		return "az-automation"
+	}
+	return fmt.Sprintf("%s-terraform", name)
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,185 @@
+package wizard_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/genevieve/az-automation/az"
+	"github.com/genevieve/az-automation/az/fakes"
+	"github.com/genevieve/az-automation/wizard"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wizard", func() {
+	var (
+		cli    *fakes.CLI
+		output *bytes.Buffer
+		input  string
+	)
+
+	BeforeEach(func() {
+		cli = &fakes.CLI{}
+		cli.ExecuteCall.Returns.Output = `[
+			{"name": "Dev Subscription", "id": "dev-id", "tenantId": "tenant-id", "isDefault": false},
+			{"name": "Prod Subscription", "id": "prod-id", "tenantId": "tenant-id", "isDefault": true}
+		]`
+		output = bytes.NewBuffer([]byte{})
+	})
+
+	run := func(defaults wizard.Answers) (wizard.Answers, error) {
+		w := wizard.New(strings.NewReader(input), output, az.NewAz(cli, &fakes.Logger{}))
+		return w.Run(context.Background(), defaults)
+	}
+
+	Describe("Run", func() {
+		Context("when every proposal is accepted", func() {
+			BeforeEach(func() {
+				input = "\n\n\n\n\n\n\ny\n"
+			})
+
+			It("uses the default account and proposed names", func() {
+				answers, err := run(wizard.Answers{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cli.ExecuteCall.Receives.Args).To(Equal([]string{"account", "list"}))
+				Expect(answers).To(Equal(wizard.Answers{
+					Account:                "prod-id",
+					DisplayName:            "prod-subscription-terraform",
+					IdentifierUri:          "auto",
+					Roles:                  []string{"Contributor"},
+					CredentialOutputFormat: "tfvars",
+					CredentialOutputFile:   "creds.tfvars",
+				}))
+
+				Expect(output.String()).To(ContainSubstring("  1) Dev Subscription (dev-id)\n  2) Prod Subscription (prod-id)\n"))
+				Expect(output.String()).To(ContainSubstring("Account [2]: "))
+				Expect(output.String()).To(ContainSubstring("  Scope:          /subscriptions/prod-id\n"))
+			})
+		})
+
+		Context("when the answers are entered", func() {
+			BeforeEach(func() {
+				input = strings.Join([]string{
+					"3",
+					"1",
+					"my-app",
+					"",
+					"Reader, Storage Blob Data Reader",
+					"/subscriptions/dev-id/resourceGroups/my-group",
+					"banana",
+					"kubernetes-secret",
+					"",
+					"yes",
+				}, "\n") + "\n"
+			})
+
+			It("uses them", func() {
+				answers, err := run(wizard.Answers{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(answers).To(Equal(wizard.Answers{
+					Account:                "dev-id",
+					DisplayName:            "my-app",
+					IdentifierUri:          "auto",
+					Roles:                  []string{"Reader", "Storage Blob Data Reader"},
+					Scope:                  "/subscriptions/dev-id/resourceGroups/my-group",
+					CredentialOutputFormat: "kubernetes-secret",
+					CredentialOutputFile:   "azure-credentials.yml",
+				}))
+
+				Expect(output.String()).To(ContainSubstring("Please enter a number between 1 and 2."))
+				Expect(output.String()).To(ContainSubstring("Please enter one of tfvars, kubernetes-secret, azure-json, sdk-auth."))
+			})
+		})
+
+		Context("when the azure-json format is chosen", func() {
+			BeforeEach(func() {
+				input = strings.Join([]string{
+					"",
+					"",
+					"",
+					"",
+					"",
+					"azure-json",
+					"",
+					"my-cluster-group",
+					"",
+					"westus",
+					"",
+					"y",
+				}, "\n") + "\n"
+			})
+
+			It("asks for the resource group and location of the cluster", func() {
+				answers, err := run(wizard.Answers{})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(answers.CredentialOutputFormat).To(Equal("azure-json"))
+				Expect(answers.CredentialOutputFile).To(Equal("azure.json"))
+				Expect(answers.ResourceGroup).To(Equal("my-cluster-group"))
+				Expect(answers.Location).To(Equal("westus"))
+
+				Expect(output.String()).To(ContainSubstring("Please enter a value."))
+				Expect(output.String()).To(ContainSubstring("  Cluster:        my-cluster-group (westus)\n"))
+			})
+		})
+
+		Context("when some answers were given as flags", func() {
+			BeforeEach(func() {
+				input = "\n\n\n\n\n\n\ny\n"
+			})
+
+			It("offers them as the defaults", func() {
+				answers, err := run(wizard.Answers{
+					Account:                "Dev Subscription",
+					DisplayName:            "my-app",
+					CredentialOutputFormat: "tfvars",
+					CredentialOutputFile:   "my.tfvars",
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(answers.Account).To(Equal("dev-id"))
+				Expect(answers.DisplayName).To(Equal("my-app"))
+				Expect(answers.CredentialOutputFile).To(Equal("my.tfvars"))
+			})
+		})
+
+		Context("when the summary is not confirmed", func() {
+			BeforeEach(func() {
+				input = "\n\n\n\n\n\n\nn\n"
+			})
+
+			It("aborts", func() {
+				_, err := run(wizard.Answers{})
+				Expect(err).To(Equal(wizard.Aborted))
+			})
+		})
+
+		Context("when the input ends early", func() {
+			BeforeEach(func() {
+				input = "\n"
+			})
+
+			It("aborts", func() {
+				_, err := run(wizard.Answers{})
+				Expect(err).To(Equal(wizard.Aborted))
+			})
+		})
+
+		Context("when the accounts cannot be listed", func() {
+			BeforeEach(func() {
+				cli.ExecuteCall.Returns.Error = errors.New("some error")
+				cli.ExecuteCall.Returns.Output = "the error message"
+			})
+
+			It("returns the error", func() {
+				_, err := run(wizard.Answers{})
+				Expect(err).To(MatchError("Please login to the azure-cli."))
+			})
+		})
+	})
+})